@@ -1,20 +1,27 @@
 package main
 
 import (
-	"crypto/sha256"
-	"fmt"
-	"io"
+	"errors"
+	"flag"
 	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
-
-	"httpFromTcp/internal/headers"
+	"time"
+
+	"httpFromTcp/internal/accesslog"
+	"httpFromTcp/internal/compress"
+	"httpFromTcp/internal/cors"
+	"httpFromTcp/internal/fileserver"
+	"httpFromTcp/internal/metrics"
+	"httpFromTcp/internal/proxy"
+	"httpFromTcp/internal/ratelimit"
 	"httpFromTcp/internal/request"
 	"httpFromTcp/internal/response"
 	"httpFromTcp/internal/server"
+	"httpFromTcp/internal/trace"
 )
 
 const port = 42069
@@ -52,10 +59,54 @@ const successHTML = `<html>
 	`
 
 func main() {
+	certFile := flag.String("cert", "", "TLS certificate file, enables TLS together with -key")
+	keyFile := flag.String("key", "", "TLS private key file")
+	clientCA := flag.String("client-ca", "", "CA file used to verify client certificates")
+	requireClientCert := flag.Bool("require-client-cert", false, "reject clients without a verified certificate")
+	maxBody := flag.Int64("max-body", 10<<20, "largest request body accepted, in bytes")
+	assetsDir := flag.String("assets", "../../assets", "directory served under /assets/")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 10*time.Second, "time a client has to send the request headers, 0 for no limit")
+	maxConns := flag.Int("max-conns", 0, "connections served at once, 0 for no limit")
+	maxConnsPerIP := flag.Int("max-conns-per-ip", 0, "connections served at once per client IP, 0 for no limit")
+	workers := flag.Int("workers", 0, "serve connections from a fixed pool of workers, 0 starts a goroutine per connection")
+	rejectOverload := flag.Bool("reject-overload", false, "answer connections over the limits with 503 instead of leaving them queued")
+	rateLimit := flag.Float64("rate-limit", 0, "requests per second allowed per client IP, 0 disables rate limiting")
+	rateBurst := flag.Int("rate-burst", 20, "requests a client IP may send in a burst")
+	accessLog := flag.String("access-log", "common", "access log format written to stdout: common, combined or json, empty disables it")
+	serveMetrics := flag.Bool("metrics", true, "serve Prometheus metrics under /metrics")
+	traceFile := flag.String("trace-file", "", "append finished spans to this file as OTLP/JSON, empty disables tracing")
+	corsOrigins := flag.String("cors-origins", "", "comma separated origins allowed to make cross-origin requests, empty disables CORS")
+	logLevel := flag.String("log-level", "info", "server log level: debug, info, warn or error")
+	flag.Parse()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatalf("Error configuring logging: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	assets := fileserver.New(*assetsDir, fileserver.WithStripPrefix("/assets"))
+
+	httpbin, err := proxy.New("https://httpbin.org",
+		proxy.WithStripPrefix("/httpbin"),
+		proxy.WithIntegrityTrailers(),
+	)
+	if err != nil {
+		log.Fatalf("Error configuring proxy: %v", err)
+	}
+
+	routes := metrics.Routes("/", "/yourproblem", "/myproblem", "/httpbin/", "/assets/", "/video", "/metrics")
+	registry := metrics.NewRegistry()
+	httpMetrics := metrics.NewHTTP(registry, metrics.WithRoute(routes))
+
 	var handlerFn server.Handler = func(w *response.Writer, req *request.Request) {
 		defaultContentType := "text/html"
 
 		s := req.RequestLine.RequestTarget
+		if s == "/metrics" && *serveMetrics {
+			registry.Handle(w, req)
+			return
+		}
 		if s == "/yourproblem" {
 			w.WriteStatusLine(400)
 			defaultHeaders := response.GetDefaultHeaders(len(badRequestHTML), defaultContentType, false)
@@ -73,61 +124,15 @@ func main() {
 			w.WriteBody([]byte(internalErrorHTML))
 		}
 		if strings.HasPrefix(s, "/httpbin/") {
-			// defaultHeaders := response.GetDefaultHeaders(0, defaultContentType, true)
-			// req.Headers = defaultHeaders
-
-			url := "https://httpbin.org" + strings.TrimPrefix(s, "/httpbin")
-			res, err := http.Get(url)
-			if err != nil {
-				panic("TODO")
-			}
-			defer res.Body.Close()
-
-			w.WriteStatusLine(response.StatusCode(res.StatusCode))
-
-			hdrs := headers.NewHeaders()
-			for k, v := range res.Header {
-				hdrs[strings.ToLower(k)] = strings.Join(v, ",")
-			}
-			delete(hdrs, "content-length")
-			hdrs["transfer-encoding"] = "chunked"
-			hdrs["trailer"] = "X-Content-SHA256,X-Content-Length"
-
-			w.WriteHeaders(hdrs)
-			w.Writer.Write([]byte("\r\n"))
-
-			buf := make([]byte, 1024)
-			fullResp := make([]byte, 60000) // TODO:
-			for {
-				n, err := res.Body.Read(buf)
-				if n > 0 {
-					w.WriteChunkedBody(buf[:n])
-					fullResp = append(fullResp, buf[:n]...)
-				}
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					// handle error (and likely break)
-					break
-				}
-			}
-			w.WriteChunkedBodyDone()
-			sha := sha256.Sum256(fullResp)
-			tr := headers.NewHeaders()
-			tr["X-Content-SHA256"] = fmt.Sprintf("%x", sha[:])
-			tr["X-Content-Length"] = fmt.Sprint(len(fullResp))
-			w.WriteTrailers(tr)
-
+			httpbin.Handle(w, req)
+			return
+		}
+		if strings.HasPrefix(s, "/assets/") {
+			assets.Handle(w, req)
+			return
 		}
 		if s == "/video" {
-			w.WriteStatusLine(200)
-			video, _ := os.ReadFile("../../assets/vim.mp4")
-			defaultHeaders := response.GetDefaultHeaders(len(video), "video/mp4", false)
-			req.Headers = defaultHeaders
-			w.WriteHeaders(req.Headers)
-			w.Writer.Write([]byte("\r\n"))
-			w.WriteBody([]byte(video))
+			assets.ServeFile(w, req, "vim.mp4")
 		} else {
 			w.WriteStatusLine(200)
 			defaultHeaders := response.GetDefaultHeaders(len(successHTML), defaultContentType, false)
@@ -138,11 +143,69 @@ func main() {
 		}
 	}
 
-	server, err := server.Serve(port, handlerFn)
+	var middlewares []server.Middleware
+	if *accessLog != "" {
+		format, err := accesslog.ParseFormat(*accessLog)
+		if err != nil {
+			log.Fatalf("Error configuring access log: %v", err)
+		}
+		middlewares = append(middlewares, accesslog.New(os.Stdout, accesslog.WithFormat(format)))
+	}
+	middlewares = append(middlewares, httpMetrics.Middleware())
+	if *traceFile != "" {
+		exporter, err := trace.NewFileExporter(*traceFile, "httpfromtcp")
+		if err != nil {
+			log.Fatalf("Error configuring tracing: %v", err)
+		}
+		tracer := trace.NewTracer(exporter)
+		defer tracer.Shutdown()
+		middlewares = append(middlewares, trace.New(tracer, trace.WithRoute(routes)))
+	}
+	if *corsOrigins != "" {
+		middlewares = append(middlewares, cors.New(
+			cors.WithOrigins(strings.Split(*corsOrigins, ",")...),
+			cors.WithMethods("GET", "HEAD", "POST", "PUT", "DELETE"),
+			cors.WithHeaders("*"),
+			cors.WithMaxAge(time.Hour),
+		))
+	}
+	// Rate limiting comes after CORS so browsers can read its 429s.
+	if *rateLimit > 0 {
+		if *rateBurst < 1 {
+			log.Fatalf("Error configuring rate limiting: -rate-burst must be at least 1")
+		}
+		middlewares = append(middlewares, ratelimit.New(ratelimit.NewTokenBucket(*rateLimit, *rateBurst)))
+	}
+	middlewares = append(middlewares, compress.New(), compress.DecodeRequests())
+	handlerFn = server.Chain(handlerFn, middlewares...)
+
+	opts, err := tlsOptions(*certFile, *keyFile, *clientCA, *requireClientCert)
+	if err != nil {
+		log.Fatalf("Error configuring TLS: %v", err)
+	}
+
+	opts = append(opts,
+		server.WithMaxBodySize(*maxBody),
+		server.WithReadHeaderTimeout(*readHeaderTimeout),
+		server.WithMaxConnections(*maxConns),
+		server.WithMaxConnectionsPerIP(*maxConnsPerIP),
+		server.WithBufferPool(4096),
+		server.WithParseErrorHook(httpMetrics.ParseError),
+		server.WithLogger(logger),
+	)
+	if *workers > 0 {
+		opts = append(opts, server.WithWorkerPool(*workers, *workers*16))
+	}
+	if *rejectOverload {
+		opts = append(opts, server.WithOverloadPolicy(server.RejectUnavailable, 5*time.Second))
+	}
+
+	server, err := server.Serve(port, handlerFn, opts...)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
 	defer server.Close()
+	metrics.RegisterConnStats(registry, server.ConnStats)
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
@@ -150,3 +213,39 @@ func main() {
 	<-sigChan
 	log.Println("Server gracefully stopped")
 }
+
+func tlsOptions(certFile, keyFile, clientCA string, requireClientCert bool) ([]server.Option, error) {
+	switch {
+	case certFile == "" && keyFile == "":
+		if clientCA != "" || requireClientCert {
+			return nil, errors.New("-client-ca and -require-client-cert need -cert and -key")
+		}
+		return nil, nil
+	case certFile == "":
+		return nil, errors.New("-key needs -cert")
+	case keyFile == "":
+		return nil, errors.New("-cert needs -key")
+	case requireClientCert && clientCA == "":
+		return nil, errors.New("-require-client-cert needs -client-ca")
+	}
+
+	config, err := server.LoadTLSConfig(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	opts := []server.Option{server.WithTLS(config)}
+
+	if clientCA != "" {
+		pool, err := server.LoadCertPool(clientCA)
+		if err != nil {
+			return nil, err
+		}
+		mode := server.OptionalClientCert
+		if requireClientCert {
+			mode = server.RequireClientCert
+		}
+		opts = append(opts, server.WithClientAuth(pool, mode))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,199 @@
+// Package accesslog records one entry per request in Common Log Format,
+// Combined Log Format or as structured JSON.
+package accesslog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"httpFromTcp/internal/auth"
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+type Format int
+
+const (
+	// Common is the Common Log Format of the NCSA and Apache servers.
+	Common Format = iota
+	// Combined is Common followed by the referrer and user agent.
+	Combined
+	// JSON logs through log/slog, adding the duration and request ID.
+	JSON
+)
+
+// ParseFormat returns the format called "common", "combined" or "json".
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "common":
+		return Common, nil
+	case "combined":
+		return Combined, nil
+	case "json":
+		return JSON, nil
+	default:
+		return 0, fmt.Errorf("unknown access log format: %q", s)
+	}
+}
+
+// RequestIDHeader carries the request ID. A valid ID sent by the client or
+// a proxy in front is kept, so one request can be followed across servers.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestID bounds the length of request IDs taken from clients.
+const maxRequestID = 128
+
+// Entry is what is recorded about a request.
+type Entry struct {
+	// Time is when the request started.
+	Time time.Time
+	// RemoteAddr is the client IP.
+	RemoteAddr string
+	// User is the authenticated principal, if any.
+	User      string
+	Method    string
+	Target    string
+	Proto     string
+	Status    response.StatusCode
+	Bytes     int64
+	Duration  time.Duration
+	Referer   string
+	UserAgent string
+	RequestID string
+}
+
+type config struct {
+	format Format
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+type Option func(*config)
+
+// WithFormat sets the log format. The default is Common.
+func WithFormat(f Format) Option {
+	return func(c *config) {
+		c.format = f
+	}
+}
+
+// WithLogger logs entries through l in the JSON format, instead of a JSON
+// handler writing to the middleware's writer.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *config) {
+		c.format = JSON
+		c.logger = l
+	}
+}
+
+type contextKey struct{}
+
+// RequestID returns the ID the access log middleware gave req.
+func RequestID(req *request.Request) string {
+	id, _ := req.Context().Value(contextKey{}).(string)
+	return id
+}
+
+// New returns a middleware writing an entry to out once each request is
+// handled. It should be the outermost middleware so it sees the final
+// response. Requests get an ID, sent back in the X-Request-Id header and
+// set on the request so a proxy passes it upstream.
+func New(out io.Writer, opts ...Option) server.Middleware {
+	c := &config{now: time.Now}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.format == JSON && c.logger == nil {
+		c.logger = slog.New(slog.NewJSONHandler(out, nil))
+	}
+	var mu sync.Mutex
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := c.now()
+
+			id := req.Headers.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+				req.Headers.Set(RequestIDHeader, id)
+			}
+			req.SetContext(context.WithValue(req.Context(), contextKey{}, id))
+			w.OnHeaders(func(_ response.StatusCode, h headers.Headers) {
+				h.Set(RequestIDHeader, id)
+			})
+
+			// Log from a defer so that requests whose handler panics show
+			// up too, with the 500 the server answers them with.
+			handled := false
+			defer func() {
+				e := newEntry(w, req, start, c.now().Sub(start))
+				if !handled && w.State == response.StatusLine {
+					e.Status = response.InternalError
+				}
+				if c.format == JSON {
+					c.logger.LogAttrs(req.Context(), slog.LevelInfo, "request", e.attrs()...)
+					return
+				}
+
+				line := e.common()
+				if c.format == Combined {
+					line += e.combinedSuffix()
+				}
+				mu.Lock()
+				io.WriteString(out, line+"\n")
+				mu.Unlock()
+			}()
+
+			next(w, req)
+			handled = true
+		}
+	}
+}
+
+func newEntry(w *response.Writer, req *request.Request, start time.Time, d time.Duration) *Entry {
+	e := &Entry{
+		Time:       start,
+		RemoteAddr: req.RemoteIP(),
+		Method:     req.RequestLine.Method,
+		Target:     req.RequestLine.RequestTarget,
+		Proto:      "HTTP/" + req.RequestLine.HTTPVersion,
+		Status:     w.Status(),
+		Bytes:      w.BytesWritten(),
+		Duration:   d,
+		Referer:    req.Headers.Get("Referer"),
+		UserAgent:  req.Headers.Get("User-Agent"),
+		RequestID:  RequestID(req),
+	}
+	if p, ok := auth.PrincipalFrom(req); ok {
+		e.User = p.Name
+	}
+	return e
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts IDs made of visible ASCII without quotes or
+// backslashes, so they can be logged as they are.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] >= 0x7f || id[i] == '"' || id[i] == '\\' {
+			return false
+		}
+	}
+	return true
+}
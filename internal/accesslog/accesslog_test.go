@@ -0,0 +1,152 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/auth"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+// fixedClock advances by 1500µs on every call.
+func fixedClock() func() time.Time {
+	t := time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*3600))
+	return func() time.Time {
+		now := t
+		t = t.Add(1500 * time.Microsecond)
+		return now
+	}
+}
+
+func hello(w *response.Writer, req *request.Request) {
+	body := "hello"
+	w.WriteStatusLine(response.Ok)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody([]byte(body))
+}
+
+func do(t *testing.T, mw server.Middleware, raw string) *response.Response {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	req.RemoteAddr = "127.0.0.1:50000"
+
+	out := &bytes.Buffer{}
+	server.Chain(hello, mw)(&response.Writer{Writer: out, State: response.StatusLine}, req)
+	out.WriteString("\r\n")
+	res, err := response.ParseFromReader(out)
+	require.NoError(t, err)
+	return res
+}
+
+func TestCommon(t *testing.T) {
+	out := &bytes.Buffer{}
+	mw := New(out, withClock(fixedClock()))
+
+	res := do(t, mw, "GET /apache_pb.gif HTTP/1.1\r\nUser-Agent: curl\r\n\r\n")
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.1" 200 5`+"\n", out.String())
+
+	// Test: A request ID is generated and sent back
+	assert.Len(t, res.Headers.Get("X-Request-Id"), 32)
+}
+
+func TestCombined(t *testing.T) {
+	out := &bytes.Buffer{}
+	authenticate := func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			auth.WithPrincipal(req, &auth.Principal{Name: "frank"})
+			next(w, req)
+		}
+	}
+	mw := func(next server.Handler) server.Handler {
+		return New(out, WithFormat(Combined), withClock(fixedClock()))(authenticate(next))
+	}
+
+	do(t, mw, "GET / HTTP/1.1\r\nReferer: http://example.com/\r\nUser-Agent: Mozilla/5.0 \"x\"\r\n\r\n")
+	assert.Equal(t, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 5 "http://example.com/" "Mozilla/5.0 \"x\""`+"\n", out.String())
+
+	// Test: Missing fields
+	out.Reset()
+	do(t, mw, "GET / HTTP/1.1\r\n\r\n")
+	assert.True(t, strings.HasSuffix(out.String(), `200 5 "-" "-"`+"\n"), out.String())
+
+	// Test: Control characters cannot forge lines
+	out.Reset()
+	do(t, mw, "GET / HTTP/1.1\r\nUser-Agent: a\x1b[2Jb\r\n\r\n")
+	assert.Contains(t, out.String(), `"a\x1b[2Jb"`)
+}
+
+func TestPanic(t *testing.T) {
+	out := &bytes.Buffer{}
+	mw := New(out, withClock(fixedClock()))
+	req, err := request.RequestFromReader(strings.NewReader("GET /boom HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	req.RemoteAddr = "127.0.0.1:50000"
+
+	// Test: A panicking request is logged with the status the server sends
+	handler := server.Chain(func(w *response.Writer, req *request.Request) { panic("boom") }, mw)
+	w := &response.Writer{Writer: &bytes.Buffer{}, State: response.StatusLine}
+	assert.PanicsWithValue(t, "boom", func() { handler(w, req) })
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /boom HTTP/1.1" 500 -`+"\n", out.String())
+
+	// Test: A status already sent is kept
+	out.Reset()
+	handler = server.Chain(func(w *response.Writer, req *request.Request) {
+		hello(w, req)
+		panic("late")
+	}, mw)
+	w = &response.Writer{Writer: &bytes.Buffer{}, State: response.StatusLine}
+	assert.Panics(t, func() { handler(w, req) })
+	assert.Contains(t, out.String(), `"GET /boom HTTP/1.1" 200 5`)
+}
+
+func TestJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	mw := New(out, WithFormat(JSON), withClock(fixedClock()))
+
+	res := do(t, mw, "POST /submit HTTP/1.1\r\nX-Request-Id: abc-123\r\nUser-Agent: curl\r\nContent-Length: 2\r\n\r\nhi")
+	assert.Equal(t, "abc-123", res.Headers.Get("X-Request-Id"))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "127.0.0.1", entry["remote_addr"])
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/submit", entry["target"])
+	assert.Equal(t, "HTTP/1.1", entry["proto"])
+	assert.Equal(t, 200.0, entry["status"])
+	assert.Equal(t, 5.0, entry["bytes"])
+	assert.Equal(t, 1.5, entry["duration_ms"])
+	assert.Equal(t, "curl", entry["user_agent"])
+	assert.Equal(t, "abc-123", entry["request_id"])
+	assert.NotContains(t, entry, "referer")
+
+	// Test: Invalid incoming request IDs are replaced
+	out.Reset()
+	res = do(t, mw, "GET / HTTP/1.1\r\nX-Request-Id: has space\r\n\r\n")
+	assert.Len(t, res.Headers.Get("X-Request-Id"), 32)
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("combined")
+	require.NoError(t, err)
+	assert.Equal(t, Combined, f)
+
+	_, err = ParseFormat("xml")
+	require.Error(t, err)
+}
+
+func withClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
@@ -0,0 +1,87 @@
+package accesslog
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// clfTime is the timestamp format of the Common Log Format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// common formats e as a Common Log Format line:
+//
+//	host ident authuser [date] "request" status bytes
+func (e *Entry) common() string {
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		field(e.RemoteAddr), field(e.User), e.Time.Format(clfTime),
+		escape(e.Method), escape(e.Target), escape(e.Proto), e.Status, bytes)
+}
+
+// combinedSuffix is what the Combined Log Format adds to common.
+func (e *Entry) combinedSuffix() string {
+	return fmt.Sprintf(` "%s" "%s"`, quoted(e.Referer), quoted(e.UserAgent))
+}
+
+func (e *Entry) attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("remote_addr", e.RemoteAddr),
+		slog.String("method", e.Method),
+		slog.String("target", e.Target),
+		slog.String("proto", e.Proto),
+		slog.Int("status", int(e.Status)),
+		slog.Int64("bytes", e.Bytes),
+		slog.Float64("duration_ms", float64(e.Duration.Microseconds())/1000),
+		slog.String("request_id", e.RequestID),
+	}
+	if e.User != "" {
+		attrs = append(attrs, slog.String("user", e.User))
+	}
+	if e.Referer != "" {
+		attrs = append(attrs, slog.String("referer", e.Referer))
+	}
+	if e.UserAgent != "" {
+		attrs = append(attrs, slog.String("user_agent", e.UserAgent))
+	}
+	return attrs
+}
+
+// field formats an unquoted field, which must not contain spaces.
+func field(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(escape(s), " ", `\x20`)
+}
+
+// quoted formats a quoted field, logging a missing value as "-".
+func quoted(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return escape(s)
+}
+
+// escape makes s safe to log between double quotes the way Apache does, so
+// a client cannot forge lines or fields.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+// Package auth authenticates requests and attaches the caller's identity
+// to them.
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// Name identifies the caller, such as a user name or key ID.
+	Name string
+	// Scheme is the authentication scheme that verified it, such as Basic.
+	Scheme string
+	// Attributes holds anything else the verifier knows about the caller.
+	Attributes map[string]string
+	// Claims holds the verified claims of callers authenticated by a token
+	// such as a JWT.
+	Claims map[string]any
+}
+
+type contextKey struct{}
+
+// WithPrincipal attaches p to req.
+func WithPrincipal(req *request.Request, p *Principal) {
+	req.SetContext(context.WithValue(req.Context(), contextKey{}, p))
+}
+
+// PrincipalFrom returns the principal attached by an auth middleware.
+func PrincipalFrom(req *request.Request) (*Principal, bool) {
+	p, ok := req.Context().Value(contextKey{}).(*Principal)
+	return p, ok
+}
+
+// unauthorized answers with 401 and a WWW-Authenticate challenge.
+func unauthorized(w *response.Writer, challenge string) {
+	status := response.Unauthorized
+	body := fmt.Sprintf("%d %s\n", status, response.StatusText(status))
+	h := response.GetDefaultHeaders(len(body), "text/plain", false)
+	h["WWW-Authenticate"] = challenge
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody([]byte(body))
+}
+
+// quote returns s as an auth-param quoted string.
+func quote(s string) string {
+	out := make([]byte, 0, len(s)+2)
+	out = append(out, '"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			out = append(out, '\\')
+		}
+		out = append(out, s[i])
+	}
+	return string(append(out, '"'))
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+// whoami answers with the name of the authenticated principal.
+var whoami server.Handler = func(w *response.Writer, req *request.Request) {
+	p, ok := PrincipalFrom(req)
+	if !ok {
+		panic("handler reached without a principal")
+	}
+	body := p.Scheme + " " + p.Name
+	w.WriteStatusLine(response.Ok)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody([]byte(body))
+}
+
+func serve(t *testing.T, handler server.Handler, raw string) *response.Response {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	handler(&response.Writer{Writer: out, State: response.StatusLine}, req)
+	out.WriteString("\r\n")
+
+	r, err := response.ParseFromReader(out)
+	require.NoError(t, err)
+	return r
+}
+
+func withAuthorization(value string) string {
+	raw := "GET / HTTP/1.1\r\nHost: localhost:42069\r\n"
+	if value != "" {
+		raw += "Authorization: " + value + "\r\n"
+	}
+	return raw + "\r\n"
+}
+
+func TestBasic(t *testing.T) {
+	handler := Basic(`my "realm"`, Users(map[string]string{"alice": "s3cret:with colon"}))(whoami)
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	// Test: Valid credentials
+	r := serve(t, handler, withAuthorization(basic("alice:s3cret:with colon")))
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, "Basic alice", string(r.Body))
+
+	// Test: Scheme is case-insensitive
+	r = serve(t, handler, withAuthorization(strings.Replace(basic("alice:s3cret:with colon"), "Basic", "basic", 1)))
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+
+	// Test: Rejected requests get a challenge
+	for _, value := range []string{
+		"",
+		basic("alice:wrong"),
+		basic("bob:s3cret:with colon"),
+		basic("alice"),
+		"Basic !!!",
+		"Bearer abc",
+	} {
+		r = serve(t, handler, withAuthorization(value))
+		assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode, value)
+		assert.Equal(t, `Basic realm="my \"realm\"", charset="UTF-8"`, r.Headers.Get("WWW-Authenticate"), value)
+	}
+}
+
+func TestBearer(t *testing.T) {
+	verify := func(token string) (*Principal, error) {
+		if token != "good-token" {
+			return nil, errors.New("unknown token")
+		}
+		return &Principal{Name: "service-a", Attributes: map[string]string{"scope": "read"}}, nil
+	}
+	handler := Bearer("api", verify)(whoami)
+
+	// Test: Valid token
+	r := serve(t, handler, withAuthorization("Bearer good-token"))
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, "Bearer service-a", string(r.Body))
+
+	// Test: Missing token
+	r = serve(t, handler, withAuthorization(""))
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+	assert.Equal(t, `Bearer realm="api"`, r.Headers.Get("WWW-Authenticate"))
+
+	// Test: Invalid token
+	r = serve(t, handler, withAuthorization("Bearer bad-token"))
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+	assert.Equal(t, `Bearer realm="api", error="invalid_token"`, r.Headers.Get("WWW-Authenticate"))
+}
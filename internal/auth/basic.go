@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+// CheckFunc reports whether the credentials are valid.
+type CheckFunc func(user, password string) bool
+
+// Users returns a CheckFunc accepting the given user names and passwords.
+// Passwords are compared in constant time, and unknown users take as long
+// to reject as wrong passwords.
+func Users(users map[string]string) CheckFunc {
+	hashes := make(map[string][32]byte, len(users))
+	for user, password := range users {
+		hashes[user] = sha256.Sum256([]byte(password))
+	}
+	// Compared against when the user is unknown.
+	var missing [32]byte
+
+	return func(user, password string) bool {
+		want, ok := hashes[user]
+		if !ok {
+			want = missing
+		}
+		got := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(got[:], want[:]) == 1 && ok
+	}
+}
+
+// Basic returns a middleware requiring HTTP Basic credentials accepted by
+// check. Other requests get a 401 challenge for realm.
+func Basic(realm string, check CheckFunc) server.Middleware {
+	challenge := "Basic realm=" + quote(realm) + `, charset="UTF-8"`
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			user, password, ok := basicCredentials(req)
+			if !ok || !check(user, password) {
+				unauthorized(w, challenge)
+				return
+			}
+
+			WithPrincipal(req, &Principal{Name: user, Scheme: "Basic"})
+			next(w, req)
+		}
+	}
+}
+
+func basicCredentials(req *request.Request) (string, string, bool) {
+	scheme, param, ok := strings.Cut(req.Headers.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(param))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"strings"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+// VerifyFunc checks a bearer token and returns who it belongs to.
+type VerifyFunc func(token string) (*Principal, error)
+
+// Bearer returns a middleware requiring a bearer token accepted by verify.
+func Bearer(realm string, verify VerifyFunc) server.Middleware {
+	challenge := "Bearer realm=" + quote(realm)
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			token, ok := BearerToken(req)
+			if !ok {
+				unauthorized(w, challenge)
+				return
+			}
+
+			p, err := verify(token)
+			if err != nil || p == nil {
+				unauthorized(w, challenge+`, error="invalid_token"`)
+				return
+			}
+
+			if p.Scheme == "" {
+				p.Scheme = "Bearer"
+			}
+			WithPrincipal(req, p)
+			next(w, req)
+		}
+	}
+}
+
+// BearerToken returns the token from an Authorization: Bearer header.
+func BearerToken(req *request.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(req.Headers.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
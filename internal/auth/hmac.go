@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"httpFromTcp/internal/client"
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+// HMACScheme is the Authorization scheme of signed requests:
+//
+//	Authorization: HMAC-SHA256 keyId="k1", headers="host date", signature="..."
+//
+// The signature covers the method and target, the listed headers and a
+// digest of the body, in the form built by StringToSign.
+const HMACScheme = "HMAC-SHA256"
+
+const (
+	dateFormat         = "Mon, 02 Jan 2006 15:04:05 GMT"
+	defaultMaxSkew     = 5 * time.Minute
+	requestTargetField = "(request-target)"
+)
+
+// KeyFunc returns the secret for a key ID.
+type KeyFunc func(keyID string) ([]byte, bool)
+
+type hmacConfig struct {
+	required []string
+	maxSkew  time.Duration
+	now      func() time.Time
+}
+
+type HMACOption func(*hmacConfig)
+
+// WithRequiredHeaders sets the headers every signature must cover. The
+// default is host and date.
+func WithRequiredHeaders(names ...string) HMACOption {
+	return func(c *hmacConfig) {
+		c.required = lowerAll(names)
+	}
+}
+
+// WithMaxSkew sets how far the signed Date header may be from the server's
+// clock, which bounds how long a captured request can be replayed. Zero
+// disables the check.
+func WithMaxSkew(d time.Duration) HMACOption {
+	return func(c *hmacConfig) {
+		c.maxSkew = d
+	}
+}
+
+// HMAC returns a middleware requiring requests signed with a key known to
+// keys. The principal is named after the key ID.
+func HMAC(keys KeyFunc, opts ...HMACOption) server.Middleware {
+	cfg := &hmacConfig{
+		required: []string{"host", "date"},
+		maxSkew:  defaultMaxSkew,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			keyID, err := cfg.verify(keys, req)
+			if err != nil {
+				unauthorized(w, HMACScheme+` error=`+quote(err.Error()))
+				return
+			}
+
+			WithPrincipal(req, &Principal{Name: keyID, Scheme: HMACScheme})
+			next(w, req)
+		}
+	}
+}
+
+func (cfg *hmacConfig) verify(keys KeyFunc, req *request.Request) (string, error) {
+	scheme, rest, _ := strings.Cut(req.Headers.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, HMACScheme) {
+		return "", fmt.Errorf("missing signature")
+	}
+
+	params := parseParams(rest)
+	keyID, signed := params["keyid"], strings.Fields(strings.ToLower(params["headers"]))
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if keyID == "" || err != nil || len(signature) == 0 {
+		return "", fmt.Errorf("malformed signature")
+	}
+
+	for _, name := range cfg.required {
+		if !slices.Contains(signed, name) {
+			return "", fmt.Errorf("%s is not signed", name)
+		}
+	}
+	for _, name := range signed {
+		if req.Headers.Get(name) == "" {
+			return "", fmt.Errorf("signed header %s is missing", name)
+		}
+	}
+
+	if cfg.maxSkew > 0 && slices.Contains(signed, "date") {
+		date, err := time.Parse(dateFormat, req.Headers.Get("Date"))
+		if err != nil {
+			return "", fmt.Errorf("invalid date")
+		}
+		if skew := cfg.now().Sub(date).Abs(); skew > cfg.maxSkew {
+			return "", fmt.Errorf("date is too far from server time")
+		}
+	}
+
+	key, ok := keys(keyID)
+	if !ok {
+		return "", fmt.Errorf("unknown key")
+	}
+
+	body, err := req.ReadBody()
+	if err != nil {
+		return "", fmt.Errorf("unreadable body")
+	}
+
+	want := mac(key, StringToSign(req.RequestLine.Method, req.RequestLine.RequestTarget, req.Headers, signed, body))
+	if !hmac.Equal(signature, want) {
+		return "", fmt.Errorf("invalid signature")
+	}
+
+	return keyID, nil
+}
+
+// StringToSign returns the text covered by a request signature: one line
+// per signed field, ending with the body digest.
+func StringToSign(method, target string, h headers.Headers, signed []string, body []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s %s\n", requestTargetField, strings.ToLower(method), target)
+	for _, name := range signed {
+		fmt.Fprintf(&b, "%s: %s\n", strings.ToLower(name), strings.TrimSpace(h.Get(name)))
+	}
+	digest := sha256.Sum256(body)
+	fmt.Fprintf(&b, "digest: SHA-256=%s", base64.StdEncoding.EncodeToString(digest[:]))
+	return b.String()
+}
+
+// Sign signs req with key, covering the host and date headers plus any
+// other headers listed. Host and Date are filled in when missing.
+func Sign(req *client.Request, keyID string, key []byte, signed ...string) error {
+	signed = append([]string{"host", "date"}, lowerAll(signed)...)
+	slices.Sort(signed)
+	signed = slices.Compact(signed)
+
+	if req.Headers.Get("Host") == "" {
+		req.Headers.Set("Host", req.URL.Host)
+	}
+	if req.Headers.Get("Date") == "" {
+		req.Headers.Set("Date", time.Now().UTC().Format(dateFormat))
+	}
+	for _, name := range signed {
+		if req.Headers.Get(name) == "" {
+			return fmt.Errorf("signed header %s is missing", name)
+		}
+	}
+
+	signature := mac(key, StringToSign(req.Method, req.URL.RequestURI(), req.Headers, signed, req.Body))
+	req.Headers.Set("Authorization", fmt.Sprintf("%s keyId=%s, headers=%s, signature=%s",
+		HMACScheme, quote(keyID), quote(strings.Join(signed, " ")),
+		quote(base64.StdEncoding.EncodeToString(signature))))
+	return nil
+}
+
+func mac(key []byte, s string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
+
+// parseParams parses comma separated auth-params. Names are lowercased.
+func parseParams(s string) map[string]string {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		var value strings.Builder
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			token, after, _ := strings.Cut(rest, ",")
+			value.WriteString(strings.TrimSpace(token))
+			s = after
+		}
+		params[name] = value.String()
+	}
+}
+
+func lowerAll(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = strings.ToLower(name)
+	}
+	return out
+}
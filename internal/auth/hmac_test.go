@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/client"
+	"httpFromTcp/internal/response"
+)
+
+var hmacKeys KeyFunc = func(keyID string) ([]byte, bool) {
+	if keyID == "k1" {
+		return []byte("top secret"), true
+	}
+	return nil, false
+}
+
+// rawRequest renders req as it would go on the wire.
+func rawRequest(req *client.Request) string {
+	raw := fmt.Sprintf("%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	for k, v := range req.Headers {
+		raw += k + ": " + v + "\r\n"
+	}
+	if len(req.Body) > 0 {
+		raw += fmt.Sprintf("Content-Length: %d\r\n", len(req.Body))
+	}
+	return raw + "\r\n" + string(req.Body)
+}
+
+func signedRequest(t *testing.T, body string, signed ...string) *client.Request {
+	t.Helper()
+	req, err := client.NewRequest("POST", "http://localhost:42069/orders?id=7", []byte(body))
+	require.NoError(t, err)
+	req.Headers.Set("X-Tenant", "acme")
+	require.NoError(t, Sign(req, "k1", []byte("top secret"), signed...))
+	return req
+}
+
+func TestHMAC(t *testing.T) {
+	handler := HMAC(hmacKeys, WithRequiredHeaders("host", "date", "x-tenant"))(whoami)
+
+	// Test: Valid signature
+	req := signedRequest(t, `{"qty":1}`, "X-Tenant")
+	r := serve(t, handler, rawRequest(req))
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, HMACScheme+" k1", string(r.Body))
+
+	// Test: Tampered body
+	tampered := *req
+	tampered.Body = []byte(`{"qty":9}`)
+	r = serve(t, handler, rawRequest(&tampered))
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+	assert.Contains(t, r.Headers.Get("WWW-Authenticate"), "invalid signature")
+
+	// Test: Tampered target
+	tampered = *req
+	tampered.URL = req.URL.JoinPath("admin")
+	r = serve(t, handler, rawRequest(&tampered))
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+
+	// Test: Tampered signed header
+	req = signedRequest(t, "", "X-Tenant")
+	req.Headers.Set("X-Tenant", "evil")
+	r = serve(t, handler, rawRequest(req))
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+
+	// Test: Required header left unsigned
+	r = serve(t, handler, rawRequest(signedRequest(t, "")))
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+	assert.Contains(t, r.Headers.Get("WWW-Authenticate"), "x-tenant is not signed")
+
+	// Test: Unknown key
+	req, err := client.NewRequest("GET", "http://localhost:42069/", nil)
+	require.NoError(t, err)
+	require.NoError(t, Sign(req, "k2", []byte("top secret")))
+	r = serve(t, HMAC(hmacKeys)(whoami), rawRequest(req))
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+	assert.Contains(t, r.Headers.Get("WWW-Authenticate"), "unknown key")
+
+	// Test: Missing signature
+	r = serve(t, handler, withAuthorization(""))
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+	assert.Equal(t, HMACScheme+` error="missing signature"`, r.Headers.Get("WWW-Authenticate"))
+}
+
+func TestHMACSkew(t *testing.T) {
+	req := signedRequest(t, "")
+	raw := rawRequest(req)
+
+	// Test: Replay after the skew window
+	handler := HMAC(hmacKeys, WithMaxSkew(time.Minute), func(c *hmacConfig) {
+		c.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	})(whoami)
+	r := serve(t, handler, raw)
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+	assert.Contains(t, r.Headers.Get("WWW-Authenticate"), "too far")
+
+	// Test: Check disabled
+	handler = HMAC(hmacKeys, WithMaxSkew(0), func(c *hmacConfig) {
+		c.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	})(whoami)
+	r = serve(t, handler, raw)
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+}
+
+func TestParseParams(t *testing.T) {
+	params := parseParams(`keyId="k1",headers="host date" , signature="a\"b", bare=tok`)
+	assert.Equal(t, map[string]string{
+		"keyid":     "k1",
+		"headers":   "host date",
+		"signature": `a"b`,
+		"bare":      "tok",
+	}, params)
+}
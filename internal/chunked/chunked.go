@@ -0,0 +1,175 @@
+// Package chunked decodes the chunked transfer coding (RFC 9112 section 7.1)
+package chunked
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"httpFromTcp/internal/headers"
+)
+
+type decoderState string
+
+const (
+	StateSize     decoderState = "chunk size"
+	StateData     decoderState = "chunk data"
+	StateDataEnd  decoderState = "chunk data end"
+	StateTrailers decoderState = "trailers"
+	StateDone     decoderState = "done"
+)
+
+const (
+	// maxChunkSize keeps the size line from overflowing an int.
+	maxChunkSize = 1 << 40
+	// maxTrailerSize bounds the trailer section like the request head,
+	// since parsing repeated fields gets slower as they grow.
+	maxTrailerSize = 64 << 10
+)
+
+var ErrTrailersTooLarge = errors.New("trailers too large")
+
+var crlf = []byte("\r\n")
+
+// Decoder is an incremental chunked body decoder. Decoded data is appended to
+// Body and trailer fields are collected into Trailers.
+type Decoder struct {
+	State     decoderState
+	Body      []byte
+	Trailers  headers.Headers
+	remaining int
+	// trailerSize counts the trailer bytes consumed so far.
+	trailerSize int
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		State:    StateSize,
+		Trailers: headers.NewHeaders(),
+	}
+}
+
+func (d *Decoder) Done() bool {
+	return d.State == StateDone
+}
+
+// Parse decodes as much of data as possible and returns the number of bytes
+// consumed. Unconsumed bytes must be passed again with more data appended.
+func (d *Decoder) Parse(data []byte) (n int, done bool, err error) {
+	for !d.Done() {
+		consumed, err := d.parseSingle(data[n:])
+		if err != nil {
+			return n, false, err
+		}
+		if consumed == 0 {
+			break
+		}
+		n += consumed
+	}
+
+	return n, d.Done(), nil
+}
+
+func (d *Decoder) parseSingle(data []byte) (int, error) {
+	switch d.State {
+	case StateSize:
+		index := bytes.Index(data, crlf)
+		if index == -1 {
+			return 0, nil
+		}
+
+		size, err := parseSize(data[:index])
+		if err != nil {
+			return 0, err
+		}
+
+		d.remaining = size
+		if size == 0 {
+			d.State = StateTrailers
+		} else {
+			d.State = StateData
+		}
+		return index + len(crlf), nil
+
+	case StateData:
+		if len(data) == 0 {
+			return 0, nil
+		}
+
+		n := min(len(data), d.remaining)
+		d.Body = append(d.Body, data[:n]...)
+		d.remaining -= n
+		if d.remaining == 0 {
+			d.State = StateDataEnd
+		}
+		return n, nil
+
+	case StateDataEnd:
+		if len(data) < len(crlf) {
+			return 0, nil
+		}
+		if !bytes.Equal(data[:len(crlf)], crlf) {
+			return 0, fmt.Errorf("chunk data is not terminated by crlf")
+		}
+
+		d.State = StateSize
+		return len(crlf), nil
+
+	case StateTrailers:
+		n, done, err := d.Trailers.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+		d.trailerSize += n
+		// Until the trailers end, unparsed data can only be more of them.
+		if d.trailerSize > maxTrailerSize || !done && d.trailerSize+len(data)-n > maxTrailerSize {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrTrailersTooLarge, maxTrailerSize)
+		}
+		if done {
+			d.State = StateDone
+		}
+		return n, nil
+
+	default:
+		return 0, fmt.Errorf("unexpected state")
+	}
+}
+
+func parseSize(line []byte) (int, error) {
+	// Chunk extensions are allowed after the size and ignored, but not
+	// control characters in them, a bare LF being a line break to some
+	// parsers.
+	if i := bytes.IndexByte(line, ';'); i != -1 {
+		for _, c := range line[i:] {
+			if c < ' ' && c != '\t' || c == 0x7f {
+				return 0, fmt.Errorf("invalid chunk extension: %q", line[i:])
+			}
+		}
+		line = line[:i]
+	}
+	line = bytes.TrimRight(line, " \t")
+	if len(line) == 0 {
+		return 0, fmt.Errorf("empty chunk size")
+	}
+
+	for _, c := range line {
+		if !isHex(c) {
+			return 0, fmt.Errorf("invalid chunk size: %q", line)
+		}
+	}
+
+	size, err := strconv.ParseInt(string(line), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid chunk size: %q", line)
+	}
+	if size > maxChunkSize {
+		return 0, fmt.Errorf("chunk size too large: %d", size)
+	}
+
+	return int(size), nil
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,83 @@
+package chunked
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoderParse(t *testing.T) {
+	// Test: Valid chunks with trailers
+	d := NewDecoder()
+	data := []byte("5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\nX-Sum: abc\r\n\r\n")
+	n, done, err := d.Parse(data)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, "hello, world", string(d.Body))
+	assert.Equal(t, "abc", d.Trailers.Get("X-Sum"))
+
+	// Test: Valid chunks fed one byte at a time
+	d = NewDecoder()
+	data = []byte("a\r\n0123456789\r\n0\r\n\r\n")
+	buf := []byte{}
+	for i := 0; i < len(data); i++ {
+		buf = append(buf, data[i])
+		n, done, err = d.Parse(buf)
+		require.NoError(t, err)
+		buf = buf[n:]
+	}
+	assert.True(t, done)
+	assert.Empty(t, buf)
+	assert.Equal(t, "0123456789", string(d.Body))
+
+	// Test: Bytes after the last chunk are not consumed
+	d = NewDecoder()
+	data = []byte("0\r\n\r\nHTTP/1.1 200 OK\r\n")
+	n, done, err = d.Parse(data)
+	require.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 5, n)
+
+	// Test: Invalid chunk size
+	for _, size := range []string{"xyz", "+5", "-1", "0x5", "", "fffffffffffffffff"} {
+		d = NewDecoder()
+		_, _, err = d.Parse([]byte(size + "\r\nhello\r\n"))
+		require.Error(t, err, size)
+	}
+
+	// Test: Control characters in chunk extensions
+	for _, ext := range []string{";a\nb", ";a\rb", ";\x00"} {
+		d = NewDecoder()
+		_, _, err = d.Parse([]byte("5" + ext + "\r\nhello\r\n"))
+		require.Error(t, err, ext)
+	}
+
+	// Test: Chunk data longer than its size
+	d = NewDecoder()
+	_, _, err = d.Parse([]byte("3\r\nhello\r\n"))
+	require.Error(t, err)
+
+	// Test: Trailers past the size limit, complete or not
+	trailers := strings.Repeat("X-A: b\r\n", maxTrailerSize/8+1)
+	for _, data := range []string{
+		"0\r\n" + trailers + "\r\n",
+		"0\r\n" + trailers,
+		"0\r\nX-A: " + strings.Repeat("b", maxTrailerSize),
+	} {
+		d = NewDecoder()
+		_, _, err = d.Parse([]byte(data))
+		require.ErrorIs(t, err, ErrTrailersTooLarge)
+	}
+
+	// Test: Trailers past the size limit fed in pieces
+	d = NewDecoder()
+	_, _, err = d.Parse([]byte("0\r\n"))
+	require.NoError(t, err)
+	for err == nil {
+		_, _, err = d.Parse([]byte("X-A: b\r\n"))
+	}
+	require.ErrorIs(t, err, ErrTrailersTooLarge)
+}
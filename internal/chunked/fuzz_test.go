@@ -0,0 +1,91 @@
+package chunked
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httputil"
+	"testing"
+)
+
+// FuzzDecoder checks that decoding never panics, does not depend on how
+// the input arrives, keeps nothing larger than the input, and agrees with
+// net/http's chunked reader on bodies both accept.
+func FuzzDecoder(f *testing.F) {
+	for _, seed := range []string{
+		"5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\nX-Sum: abc\r\n\r\n",
+		"a\r\n0123456789\r\n0\r\n\r\n",
+		"0\r\n\r\nHTTP/1.1 200 OK\r\n",
+		"5\r\nhelloXX0\r\n\r\n",
+		"zz\r\n",
+		"\r\n",
+		"10000000000000000\r\n",
+		"5 \t\r\nhello\r\n0\r\n\r\n",
+		"5\r\nhel",
+		"0\r\nno colon\r\n\r\n",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		whole := NewDecoder()
+		n, done, err := whole.Parse(data)
+		if n > len(data) || len(whole.Body) > len(data) {
+			t.Fatalf("consumed %d and decoded %d bytes out of %d", n, len(whole.Body), len(data))
+		}
+
+		// Feed the same input one byte at a time.
+		split := NewDecoder()
+		var buf []byte
+		var splitErr error
+		for i := 0; i < len(data) && !split.Done() && splitErr == nil; i++ {
+			buf = append(buf, data[i])
+			var m int
+			m, _, splitErr = split.Parse(buf)
+			buf = buf[m:]
+		}
+		if (err != nil) != (splitErr != nil) || done != split.Done() || !bytes.Equal(whole.Body, split.Body) {
+			t.Fatalf("result depends on read size: (%v, %v, %q) vs (%v, %v, %q)",
+				done, err, whole.Body, split.Done(), splitErr, split.Body)
+		}
+
+		if !done {
+			return
+		}
+		want, err := io.ReadAll(httputil.NewChunkedReader(bytes.NewReader(data)))
+		if err == nil && !bytes.Equal(whole.Body, want) {
+			t.Fatalf("body %q, net/http %q", whole.Body, want)
+		}
+	})
+}
+
+// FuzzRoundTrip encodes a body in chunks of varying size and checks it
+// decodes back to the same bytes.
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte("hello, world"), []byte{1, 5, 200})
+	f.Add([]byte{}, []byte{})
+	f.Add(bytes.Repeat([]byte("\r\n0\r\n"), 20), []byte{3})
+
+	f.Fuzz(func(t *testing.T, body, sizes []byte) {
+		var encoded bytes.Buffer
+		rest := body
+		for i := 0; len(rest) > 0; i++ {
+			size := len(rest)
+			if len(sizes) > 0 {
+				size = min(size, int(sizes[i%len(sizes)])+1)
+			}
+			fmt.Fprintf(&encoded, "%x\r\n%s\r\n", size, rest[:size])
+			rest = rest[size:]
+		}
+		encoded.WriteString("0\r\nX-Trailer: yes\r\n\r\n")
+
+		d := NewDecoder()
+		n, done, err := d.Parse(encoded.Bytes())
+		if err != nil || !done || n != encoded.Len() {
+			t.Fatalf("decoding %q: n=%d done=%v err=%v", encoded.Bytes(), n, done, err)
+		}
+		if !bytes.Equal(d.Body, body) || d.Trailers.Get("X-Trailer") != "yes" {
+			t.Fatalf("round trip gave %q, want %q", d.Body, body)
+		}
+	})
+}
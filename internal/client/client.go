@@ -0,0 +1,364 @@
+// Package client is a small HTTP/1.1 client built on the project's own
+// header model and response parser
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/response"
+)
+
+const (
+	defaultTimeout         = 30 * time.Second
+	defaultDialTimeout     = 10 * time.Second
+	defaultIdleTimeout     = 90 * time.Second
+	defaultMaxIdlePerHost  = 2
+	defaultReadBufferBytes = 64 * 1024
+)
+
+// Request is an outgoing request.
+type Request struct {
+	Method  string
+	URL     *url.URL
+	Headers headers.Headers
+	Body    []byte
+}
+
+func NewRequest(method, rawURL string, body []byte) (*Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in url: %s", rawURL)
+	}
+
+	return &Request{
+		Method:  method,
+		URL:     u,
+		Headers: headers.NewHeaders(),
+		Body:    body,
+	}, nil
+}
+
+type Client struct {
+	timeout        time.Duration
+	dialer         *net.Dialer
+	tlsConfig      *tls.Config
+	idleTimeout    time.Duration
+	maxIdlePerHost int
+
+	mu   sync.Mutex
+	idle map[string][]*conn
+}
+
+type Option func(*Client)
+
+// WithTimeout limits the time for a whole exchange, including reading the
+// response body.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = d
+	}
+}
+
+// WithDialTimeout limits the time spent establishing a connection.
+func WithDialTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.dialer.Timeout = d
+	}
+}
+
+// WithTLSConfig sets the configuration used for https URLs.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// WithIdleConns keeps up to maxPerHost idle connections per host for at most
+// timeout. A maxPerHost of zero disables connection reuse.
+func WithIdleConns(maxPerHost int, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.maxIdlePerHost = maxPerHost
+		c.idleTimeout = timeout
+	}
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		timeout:        defaultTimeout,
+		dialer:         &net.Dialer{Timeout: defaultDialTimeout},
+		idleTimeout:    defaultIdleTimeout,
+		maxIdlePerHost: defaultMaxIdlePerHost,
+		idle:           map[string][]*conn{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Do sends req and reads the whole response.
+func (c *Client) Do(req *Request) (*response.Response, error) {
+	res, body, err := c.Stream(req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	res.Body, err = io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Stream sends req and returns the response with its body unread. The caller
+// must close body, which returns the connection to the pool once the body
+// has been read completely.
+func (c *Client) Stream(req *Request) (*response.Response, io.ReadCloser, error) {
+	cn, reused, err := c.getConn(req.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := c.roundTrip(cn, req)
+	if err != nil && reused && idempotent(req.Method) {
+		// The server may have closed an idle connection just as we picked it
+		// up, so try once more on a fresh one.
+		cn.Close()
+		cn, err = c.dial(req.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+		res, err = c.roundTrip(cn, req)
+	}
+	if err != nil {
+		cn.Close()
+		return nil, nil, err
+	}
+
+	return res, &body{
+		Reader: res.BodyReader(cn.br),
+		client: c,
+		conn:   cn,
+		res:    res,
+	}, nil
+}
+
+func (c *Client) Get(rawURL string) (*response.Response, error) {
+	req, err := NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) roundTrip(cn *conn, req *Request) (*response.Response, error) {
+	if c.timeout > 0 {
+		cn.SetDeadline(time.Now().Add(c.timeout))
+	} else {
+		cn.SetDeadline(time.Time{})
+	}
+
+	if err := writeRequest(cn.bw, req); err != nil {
+		return nil, err
+	}
+	if err := cn.bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return response.ReadHead(cn.br, req.Method)
+}
+
+// CloseIdleConnections closes all pooled connections.
+func (c *Client) CloseIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, conns := range c.idle {
+		for _, cn := range conns {
+			cn.Close()
+		}
+		delete(c.idle, key)
+	}
+}
+
+func writeRequest(w *bufio.Writer, req *Request) error {
+	target := req.URL.RequestURI()
+	_, err := fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", req.Method, target)
+	if err != nil {
+		return err
+	}
+
+	hdrs := headers.NewHeaders()
+	for k, v := range req.Headers {
+		hdrs[strings.ToLower(k)] = v
+	}
+	if hdrs["host"] == "" {
+		hdrs["host"] = req.URL.Host
+	}
+	delete(hdrs, "transfer-encoding")
+	if len(req.Body) > 0 || methodHasBody(req.Method) {
+		hdrs["content-length"] = strconv.Itoa(len(req.Body))
+	} else {
+		delete(hdrs, "content-length")
+	}
+
+	for k, v := range hdrs {
+		if _, err := fmt.Fprintf(w, "%s: %s\r\n", k, v); err != nil {
+			return err
+		}
+	}
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+
+	_, err = w.Write(req.Body)
+	return err
+}
+
+type conn struct {
+	net.Conn
+	key      string
+	br       *bufio.Reader
+	bw       *bufio.Writer
+	idleFrom time.Time
+}
+
+func (c *Client) getConn(u *url.URL) (*conn, bool, error) {
+	key := u.Scheme + "://" + hostAddr(u)
+
+	c.mu.Lock()
+	for len(c.idle[key]) > 0 {
+		conns := c.idle[key]
+		cn := conns[len(conns)-1]
+		c.idle[key] = conns[:len(conns)-1]
+		if time.Since(cn.idleFrom) < c.idleTimeout {
+			c.mu.Unlock()
+			return cn, true, nil
+		}
+		cn.Close()
+	}
+	c.mu.Unlock()
+
+	cn, err := c.dial(u)
+	return cn, false, err
+}
+
+func (c *Client) dial(u *url.URL) (*conn, error) {
+	raw, err := c.dialer.Dial("tcp", hostAddr(u))
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "https" {
+		config := &tls.Config{}
+		if c.tlsConfig != nil {
+			config = c.tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = u.Hostname()
+		}
+
+		tlsConn := tls.Client(raw, config)
+		if c.dialer.Timeout > 0 {
+			tlsConn.SetDeadline(time.Now().Add(c.dialer.Timeout))
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			raw.Close()
+			return nil, err
+		}
+		raw = tlsConn
+	}
+
+	return &conn{
+		Conn: raw,
+		key:  u.Scheme + "://" + hostAddr(u),
+		br:   bufio.NewReaderSize(raw, defaultReadBufferBytes),
+		bw:   bufio.NewWriter(raw),
+	}, nil
+}
+
+func (c *Client) putConn(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle[cn.key]) >= c.maxIdlePerHost {
+		cn.Close()
+		return
+	}
+	cn.idleFrom = time.Now()
+	c.idle[cn.key] = append(c.idle[cn.key], cn)
+}
+
+type body struct {
+	io.Reader
+	client *Client
+	conn   *conn
+	res    *response.Response
+	eof    bool
+	closed bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if errors.Is(err, io.EOF) {
+		b.eof = true
+	}
+	return n, err
+}
+
+// Close releases the connection. It is only reused if the body was read to
+// the end and the server allows it.
+func (b *body) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	if b.eof && b.res.KeepAlive() {
+		b.client.putConn(b.conn)
+		return nil
+	}
+	return b.conn.Close()
+}
+
+func hostAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func methodHasBody(method string) bool {
+	return method == "POST" || method == "PUT" || method == "PATCH"
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientDo(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Target", r.URL.RequestURI())
+		w.Header().Set("X-Custom", r.Header.Get("X-Custom"))
+		w.Write(body)
+	}))
+	defer upstream.Close()
+
+	c := New()
+	defer c.CloseIdleConnections()
+
+	// Test: POST with body and custom header
+	req, err := NewRequest("POST", upstream.URL+"/echo?q=1", []byte("ping"))
+	require.NoError(t, err)
+	req.Headers["X-Custom"] = "value"
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, int(res.StatusLine.StatusCode))
+	assert.Equal(t, "OK", res.StatusLine.ReasonPhrase)
+	assert.Equal(t, "POST", res.Headers.Get("X-Method"))
+	assert.Equal(t, "/echo?q=1", res.Headers.Get("X-Target"))
+	assert.Equal(t, "value", res.Headers.Get("X-Custom"))
+	assert.Equal(t, "ping", string(res.Body))
+
+	// Test: HEAD has no body even with a content length
+	req, err = NewRequest("HEAD", upstream.URL, nil)
+	require.NoError(t, err)
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Empty(t, res.Body)
+
+	// Test: Invalid URLs
+	_, err = NewRequest("GET", "ftp://example.com", nil)
+	require.Error(t, err)
+	_, err = NewRequest("GET", "/relative", nil)
+	require.Error(t, err)
+}
+
+func TestClientChunkedTrailers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Sum")
+		w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("world"))
+		w.Header().Set("X-Sum", "42")
+	}))
+	defer upstream.Close()
+
+	res, err := New().Get(upstream.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "chunked", res.Headers.Get("Transfer-Encoding"))
+	assert.Equal(t, "hello world", string(res.Body))
+	assert.Equal(t, "42", res.Trailers.Get("X-Sum"))
+}
+
+func TestClientConnectionPool(t *testing.T) {
+	var conns atomic.Int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pooled"))
+	}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	upstream.Start()
+	defer upstream.Close()
+
+	// Test: Sequential requests share a connection
+	c := New()
+	for i := 0; i < 5; i++ {
+		res, err := c.Get(upstream.URL)
+		require.NoError(t, err)
+		assert.Equal(t, "pooled", string(res.Body))
+	}
+	assert.Equal(t, int32(1), conns.Load())
+
+	// Test: Stale pooled connection is replaced transparently
+	upstream.CloseClientConnections()
+	res, err := c.Get(upstream.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "pooled", string(res.Body))
+
+	// Test: Pooling disabled
+	conns.Store(0)
+	c = New(WithIdleConns(0, 0))
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(upstream.URL)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(3), conns.Load())
+}
+
+func TestClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	_, err := New(WithTimeout(50 * time.Millisecond)).Get(upstream.URL)
+	require.Error(t, err)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+}
@@ -0,0 +1,208 @@
+// Package compress negotiates and applies response compression
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+const defaultMinSize = 1024
+
+// EncoderFunc returns a writer compressing into w.
+type EncoderFunc func(w io.Writer) io.WriteCloser
+
+type encoder struct {
+	name string
+	fn   EncoderFunc
+}
+
+type config struct {
+	minSize  int
+	encoders []encoder
+}
+
+type Option func(*config)
+
+// WithMinSize skips bodies with a known length below n bytes.
+func WithMinSize(n int) Option {
+	return func(c *config) {
+		c.minSize = n
+	}
+}
+
+// WithEncoder adds a content coding, preferred over those already
+// configured. An encoder with the same name as a built-in one replaces it.
+func WithEncoder(name string, fn EncoderFunc) Option {
+	return func(c *config) {
+		c.encoders = slices.DeleteFunc(c.encoders, func(e encoder) bool {
+			return e.name == name
+		})
+		c.encoders = slices.Insert(c.encoders, 0, encoder{name, fn})
+	}
+}
+
+func New(opts ...Option) server.Middleware {
+	c := &config{
+		minSize: defaultMinSize,
+		encoders: []encoder{
+			{"zstd", newZstdWriter},
+			{"br", func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }},
+			{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+			{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			enc := c.negotiate(req.Headers.Get("Accept-Encoding"))
+			noBody := req.RequestLine.Method == "HEAD"
+
+			w.OnHeaders(func(status response.StatusCode, h headers.Headers) {
+				if !compressible(h) {
+					return
+				}
+				h.AddVary("Accept-Encoding")
+
+				if enc == nil || noBody || !hasBody(status) || tooSmall(h, c.minSize) {
+					return
+				}
+
+				h.Set("Content-Encoding", enc.name)
+				h.Del("Content-Length")
+				h.Set("Transfer-Encoding", "chunked")
+				// The compressed bytes differ from the identity
+				// representation, so a strong validator no longer holds.
+				if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+					h.Set("ETag", "W/"+etag)
+				}
+				w.TransformBody(enc.fn)
+			})
+
+			next(w, req)
+			w.Finish()
+		}
+	}
+}
+
+// newZstdWriter compresses on the calling goroutine. The default of one
+// goroutine per CPU pays off for large streams, not for many small responses.
+func newZstdWriter(w io.Writer) io.WriteCloser {
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		// Only invalid options are reported here.
+		panic(err)
+	}
+	return zw
+}
+
+// negotiate picks the encoder with the highest q-value in accept. Ties go to
+// the server's order of preference.
+func (c *config) negotiate(accept string) *encoder {
+	if accept == "" {
+		return nil
+	}
+
+	qs := parseAcceptEncoding(accept)
+	var best *encoder
+	bestQ := 0.0
+	for i := range c.encoders {
+		e := &c.encoders[i]
+		q, ok := qs[e.name]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+
+	return best
+}
+
+func parseAcceptEncoding(accept string) map[string]float64 {
+	qs := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(k, "q") {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+		}
+		qs[coding] = q
+	}
+
+	return qs
+}
+
+// compressible reports whether the response is worth compressing based on
+// its headers alone.
+func compressible(h headers.Headers) bool {
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	switch {
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "font/woff"):
+		return false
+	}
+
+	switch mediaType {
+	case "application/zip", "application/gzip", "application/x-gzip",
+		"application/zstd", "application/x-7z-compressed", "application/x-rar-compressed",
+		"application/x-bzip2", "application/x-xz", "application/pdf",
+		"application/octet-stream", "multipart/byteranges":
+		return false
+	}
+	return true
+}
+
+func hasBody(status response.StatusCode) bool {
+	return status >= 200 && status != 204 && status != 304
+}
+
+func tooSmall(h headers.Headers, minSize int) bool {
+	cl := h.Get("Content-Length")
+	if cl == "" {
+		return false
+	}
+	n, err := strconv.Atoi(cl)
+	return err == nil && n < minSize
+}
@@ -0,0 +1,182 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+var page = strings.Repeat("<p>Your request was an absolute banger.</p>\n", 100)
+
+func TestCompressNegotiation(t *testing.T) {
+	handler := New()(fixedBody(page, "text/html"))
+
+	// Test: gzip
+	r := get(t, handler, "Accept-Encoding: gzip, deflate")
+	assert.Equal(t, "gzip", r.Headers.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", r.Headers.Get("Vary"))
+	assert.Equal(t, "chunked", r.Headers.Get("Transfer-Encoding"))
+	assert.Empty(t, r.Headers.Get("Content-Length"))
+	assert.Equal(t, page, gunzip(t, r.Body))
+
+	// Test: q-values
+	r = get(t, handler, "Accept-Encoding: gzip;q=0.5, deflate;q=0.8, br;q=0.2")
+	assert.Equal(t, "deflate", r.Headers.Get("Content-Encoding"))
+	zr, err := zlib.NewReader(bytes.NewReader(r.Body))
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	// Test: brotli and zstd
+	r = get(t, handler, "Accept-Encoding: br")
+	assert.Equal(t, "br", r.Headers.Get("Content-Encoding"))
+	body, err = io.ReadAll(brotli.NewReader(bytes.NewReader(r.Body)))
+	require.NoError(t, err)
+	assert.Equal(t, page, string(body))
+
+	r = get(t, handler, "Accept-Encoding: zstd")
+	assert.Equal(t, "zstd", r.Headers.Get("Content-Encoding"))
+	assert.Equal(t, page, unzstd(t, r.Body))
+
+	// Test: Ties go to the server's preference
+	r = get(t, handler, "Accept-Encoding: gzip, deflate, br, zstd")
+	assert.Equal(t, "zstd", r.Headers.Get("Content-Encoding"))
+
+	// Test: Wildcard and refused codings
+	r = get(t, handler, "Accept-Encoding: *;q=0.1, gzip;q=0")
+	assert.Equal(t, "zstd", r.Headers.Get("Content-Encoding"))
+	r = get(t, handler, "Accept-Encoding: *, zstd;q=0, br;q=0")
+	assert.Equal(t, "gzip", r.Headers.Get("Content-Encoding"))
+
+	// Test: Nothing acceptable
+	for _, accept := range []string{"", "Accept-Encoding: compress", "Accept-Encoding: gzip;q=0"} {
+		r = get(t, handler, accept)
+		assert.Empty(t, r.Headers.Get("Content-Encoding"), accept)
+		assert.Equal(t, "Accept-Encoding", r.Headers.Get("Vary"), accept)
+		assert.Equal(t, page, string(r.Body), accept)
+	}
+
+	// Test: Pluggable encoder is preferred
+	handler = New(WithEncoder("x-gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }))(fixedBody(page, "text/html"))
+	r = get(t, handler, "Accept-Encoding: zstd, x-gzip")
+	assert.Equal(t, "x-gzip", r.Headers.Get("Content-Encoding"))
+	assert.Equal(t, page, gunzip(t, r.Body))
+}
+
+func TestCompressSkips(t *testing.T) {
+	// Test: Tiny body
+	r := get(t, New()(fixedBody("tiny", "text/plain")), "Accept-Encoding: gzip")
+	assert.Empty(t, r.Headers.Get("Content-Encoding"))
+	assert.Equal(t, "4", r.Headers.Get("Content-Length"))
+	assert.Equal(t, "tiny", string(r.Body))
+
+	// Test: Already compressed media
+	r = get(t, New()(fixedBody(page, "video/mp4")), "Accept-Encoding: gzip")
+	assert.Empty(t, r.Headers.Get("Content-Encoding"))
+	assert.Empty(t, r.Headers.Get("Vary"))
+	assert.Equal(t, page, string(r.Body))
+
+	// Test: HEAD
+	handler := New()(fixedBody(page, "text/html"))
+	out := serve(t, handler, "HEAD / HTTP/1.1\r\nAccept-Encoding: gzip\r\n\r\n")
+	assert.NotContains(t, out, "content-encoding")
+	assert.Contains(t, out, fmt.Sprintf("Content-Length: %d", len(page)))
+}
+
+func TestCompressStreaming(t *testing.T) {
+	streaming := func(w *response.Writer, req *request.Request) {
+		hdrs := response.GetDefaultHeaders(0, "application/json", true)
+		hdrs["ETag"] = `"v1"`
+		hdrs["Trailer"] = "X-Count"
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(hdrs)
+		w.Writer.Write([]byte("\r\n"))
+		for i := 0; i < 50; i++ {
+			w.WriteChunkedBody([]byte(fmt.Sprintf(`{"n":%d}`, i)))
+		}
+		w.WriteChunkedBodyDone()
+		tr := headers.NewHeaders()
+		tr["X-Count"] = "50"
+		w.WriteTrailers(tr)
+	}
+
+	r := get(t, New()(streaming), "Accept-Encoding: gzip")
+	assert.Equal(t, "gzip", r.Headers.Get("Content-Encoding"))
+	assert.Equal(t, `W/"v1"`, r.Headers.Get("ETag"))
+	assert.Equal(t, "50", r.Trailers.Get("X-Count"))
+	assert.True(t, strings.HasPrefix(gunzip(t, r.Body), `{"n":0}{"n":1}`))
+
+	// Test: zstd frames survive chunked streaming
+	r = get(t, New()(streaming), "Accept-Encoding: zstd")
+	assert.Equal(t, "zstd", r.Headers.Get("Content-Encoding"))
+	assert.Equal(t, "50", r.Trailers.Get("X-Count"))
+	assert.True(t, strings.HasSuffix(unzstd(t, r.Body), `{"n":48}{"n":49}`))
+}
+
+func fixedBody(body, contentType string) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body), contentType, false))
+		w.Writer.Write([]byte("\r\n"))
+		if req.RequestLine.Method != "HEAD" {
+			w.WriteBody([]byte(body))
+		}
+	}
+}
+
+func serve(t *testing.T, handler server.Handler, raw string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	handler(&response.Writer{Writer: out, State: response.StatusLine}, req)
+	// The server terminates every message with a final CRLF.
+	out.WriteString("\r\n")
+	return out.String()
+}
+
+func get(t *testing.T, handler server.Handler, header string) *response.Response {
+	t.Helper()
+	raw := "GET / HTTP/1.1\r\n"
+	if header != "" {
+		raw += header + "\r\n"
+	}
+	r, err := response.ParseFromReader(strings.NewReader(serve(t, handler, raw+"\r\n")))
+	require.NoError(t, err)
+	return r
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func unzstd(t *testing.T, data []byte) string {
+	t.Helper()
+	zr, err := zstd.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	defer zr.Close()
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	return string(body)
+}
@@ -0,0 +1,83 @@
+package compress
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+const defaultMaxDecodedSize = 10 << 20
+
+type decodeConfig struct {
+	maxSize  int64
+	decoders map[string]request.DecoderFunc
+}
+
+type DecodeOption func(*decodeConfig)
+
+// WithMaxDecodedSize limits the size of a decoded request body. The
+// default is 10 MiB, which values of 0 or less keep.
+func WithMaxDecodedSize(n int64) DecodeOption {
+	return func(c *decodeConfig) {
+		if n > 0 {
+			c.maxSize = n
+		}
+	}
+}
+
+// WithDecoder adds or replaces a content coding for request bodies.
+func WithDecoder(name string, fn request.DecoderFunc) DecodeOption {
+	return func(c *decodeConfig) {
+		c.decoders[name] = fn
+	}
+}
+
+// DecodeRequests decodes compressed request bodies before the handler sees
+// them. Unknown codings are answered with 415 and bodies that decode to more
+// than the size limit with 413.
+func DecodeRequests(opts ...DecodeOption) server.Middleware {
+	c := &decodeConfig{
+		maxSize:  defaultMaxDecodedSize,
+		decoders: maps.Clone(request.DefaultDecoders),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			err := req.DecodeBody(c.decoders, c.maxSize)
+			switch {
+			case err == nil:
+				next(w, req)
+			case errors.Is(err, request.ErrUnsupportedEncoding):
+				// RFC 7694: tell the client which codings would work.
+				hdrs := headers.NewHeaders()
+				hdrs.Set("Accept-Encoding", strings.Join(slices.Sorted(maps.Keys(c.decoders)), ", "))
+				writeError(w, response.UnsupportedMedia, hdrs)
+			case errors.Is(err, request.ErrBodyTooLarge):
+				writeError(w, response.ContentTooLarge, headers.NewHeaders())
+			default:
+				writeError(w, response.BadRequest, headers.NewHeaders())
+			}
+		}
+	}
+}
+
+func writeError(w *response.Writer, status response.StatusCode, hdrs headers.Headers) {
+	body := fmt.Sprintf("%d %s\n", status, response.StatusText(status))
+	for k, v := range response.GetDefaultHeaders(len(body), "text/plain", false) {
+		hdrs[k] = v
+	}
+	w.WriteStatusLine(status)
+	w.WriteHeaders(hdrs)
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody([]byte(body))
+}
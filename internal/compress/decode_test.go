@@ -0,0 +1,120 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+func TestDecodeRequests(t *testing.T) {
+	var got *request.Request
+	echo := func(w *response.Writer, req *request.Request) {
+		got = req
+		fixedBody(string(req.Body), "application/json")(w, req)
+	}
+	handler := DecodeRequests(WithMaxDecodedSize(1024))(echo)
+	payload := `{"agent":"a1","events":[1,2,3]}`
+
+	// Test: gzip body
+	got = nil
+	r := post(t, handler, "gzip", gzipped(t, payload))
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, payload, string(r.Body))
+	assert.Empty(t, got.Headers.Get("Content-Encoding"))
+	assert.Equal(t, fmt.Sprint(len(payload)), got.Headers.Get("Content-Length"))
+
+	// Test: Stacked codings are undone in reverse order
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write(gzipped(t, payload))
+	zw.Close()
+	r = post(t, handler, "gzip, deflate", zbuf.Bytes())
+	assert.Equal(t, payload, string(r.Body))
+
+	// Test: brotli and zstd bodies
+	var bbuf bytes.Buffer
+	bw := brotli.NewWriter(&bbuf)
+	bw.Write([]byte(payload))
+	bw.Close()
+	r = post(t, handler, "br", bbuf.Bytes())
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, payload, string(r.Body))
+
+	r = post(t, handler, "zstd", zstdEncoded(t, payload))
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, payload, string(r.Body))
+
+	r = post(t, handler, "zstd", zstdEncoded(t, strings.Repeat("0", 1<<20)))
+	assert.Equal(t, response.ContentTooLarge, r.StatusLine.StatusCode)
+
+	r = post(t, handler, "br", []byte("not brotli at all"))
+	assert.Equal(t, response.BadRequest, r.StatusLine.StatusCode)
+
+	// Test: Unsupported coding
+	got = nil
+	r = post(t, handler, "compress", []byte("whatever"))
+	assert.Equal(t, response.UnsupportedMedia, r.StatusLine.StatusCode)
+	assert.Equal(t, "br, deflate, gzip, x-gzip, zstd", r.Headers.Get("Accept-Encoding"))
+	assert.Nil(t, got)
+
+	// Test: Compression bomb
+	r = post(t, handler, "gzip", gzipped(t, strings.Repeat("0", 1<<20)))
+	assert.Equal(t, response.ContentTooLarge, r.StatusLine.StatusCode)
+
+	// Test: Corrupt body
+	r = post(t, handler, "gzip", []byte("not gzip at all"))
+	assert.Equal(t, response.BadRequest, r.StatusLine.StatusCode)
+
+	// Test: Plain body is untouched
+	r = post(t, handler, "", []byte(payload))
+	assert.Equal(t, payload, string(r.Body))
+
+	// Test: A limit of 0 or less keeps the default
+	for _, n := range []int64{0, -1} {
+		r = post(t, DecodeRequests(WithMaxDecodedSize(n))(echo), "gzip", gzipped(t, payload))
+		assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+		assert.Equal(t, payload, string(r.Body))
+	}
+}
+
+func post(t *testing.T, handler func(*response.Writer, *request.Request), encoding string, body []byte) *response.Response {
+	t.Helper()
+	raw := fmt.Sprintf("POST / HTTP/1.1\r\nContent-Length: %d\r\n", len(body))
+	if encoding != "" {
+		raw += "Content-Encoding: " + encoding + "\r\n"
+	}
+	raw += "\r\n" + string(body)
+
+	r, err := response.ParseFromReader(strings.NewReader(serve(t, handler, raw)))
+	require.NoError(t, err)
+	return r
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func zstdEncoded(t *testing.T, s string) []byte {
+	t.Helper()
+	zw, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	defer zw.Close()
+	return zw.EncodeAll([]byte(s), nil)
+}
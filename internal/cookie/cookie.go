@@ -0,0 +1,211 @@
+// Package cookie parses Cookie headers and builds Set-Cookie headers
+// following RFC 6265
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SameSite int
+
+const (
+	// SameSiteDefault leaves the attribute out and lets the browser decide.
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// expiresFormat is the sane-cookie-date format from RFC 6265 section 4.1.1.
+const expiresFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+var (
+	ErrInvalidName  = errors.New("invalid cookie name")
+	ErrInvalidValue = errors.New("invalid cookie value")
+)
+
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge is the lifetime in seconds. Zero leaves the attribute out and a
+	// negative value deletes the cookie right away.
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Parse parses the value of a Cookie request header. Pairs that are not
+// valid per RFC 6265 are skipped.
+func Parse(header string) []*Cookie {
+	cookies := []*Cookie{}
+	for _, pair := range strings.Split(header, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !validName(name) {
+			continue
+		}
+
+		value, ok = unquote(value)
+		if !ok {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+
+	return cookies
+}
+
+// Validate checks the cookie can be sent in a Set-Cookie header.
+func (c *Cookie) Validate() error {
+	if !validName(c.Name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, c.Name)
+	}
+	if !validValue(c.Value) {
+		return fmt.Errorf("%w: %q", ErrInvalidValue, c.Value)
+	}
+	if !validAttribute(c.Path) {
+		return fmt.Errorf("invalid cookie path: %q", c.Path)
+	}
+	if !validDomain(c.Domain) {
+		return fmt.Errorf("invalid cookie domain: %q", c.Domain)
+	}
+	if c.SameSite == SameSiteNone && !c.Secure {
+		return fmt.Errorf("cookie with SameSite=None must be Secure")
+	}
+	if c.Partitioned && !c.Secure {
+		return fmt.Errorf("partitioned cookie must be Secure")
+	}
+	return nil
+}
+
+// String returns the cookie serialized for a Set-Cookie header.
+func (c *Cookie) String() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if c.Path != "" {
+		b.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=" + c.Expires.UTC().Format(expiresFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+
+	return b.String(), nil
+}
+
+// validName reports whether name is a token (RFC 9110 section 5.6.2).
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isTokenChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isTokenChar(c byte) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+}
+
+// validValue reports whether value is a cookie-value: cookie-octets,
+// optionally wrapped in double quotes.
+func validValue(value string) bool {
+	_, ok := unquote(value)
+	return ok
+}
+
+func unquote(value string) (string, bool) {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	for i := 0; i < len(value); i++ {
+		if !isCookieOctet(value[i]) {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// isCookieOctet excludes controls, whitespace, DQUOTE, comma, semicolon and
+// backslash.
+func isCookieOctet(c byte) bool {
+	return c == 0x21 || 0x23 <= c && c <= 0x2b || 0x2d <= c && c <= 0x3a ||
+		0x3c <= c && c <= 0x5b || 0x5d <= c && c <= 0x7e
+}
+
+func validAttribute(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x20 || v[i] == 0x7f || v[i] == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+func validDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" {
+		return true
+	}
+	if len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	// Test: Several cookies
+	cookies := Parse("session=abc123; theme=dark;lang=\"en\"")
+	require.Len(t, cookies, 3)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, "abc123", cookies[0].Value)
+	assert.Equal(t, "theme", cookies[1].Name)
+	assert.Equal(t, "dark", cookies[1].Value)
+	assert.Equal(t, "en", cookies[2].Value)
+
+	// Test: Empty value
+	cookies = Parse("empty=")
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "", cookies[0].Value)
+
+	// Test: Invalid pairs are skipped
+	cookies = Parse("no-equals; bad name=1; ok=1; bad=a,b; sp=a b")
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "ok", cookies[0].Name)
+
+	// Test: Empty header
+	assert.Empty(t, Parse(""))
+}
+
+func TestString(t *testing.T) {
+	// Test: All attributes
+	c := &Cookie{
+		Name:        "id",
+		Value:       "a3fWa",
+		Path:        "/",
+		Domain:      ".example.com",
+		Expires:     time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	s, err := c.String()
+	require.NoError(t, err)
+	assert.Equal(t, "id=a3fWa; Path=/; Domain=example.com; Expires=Wed, 21 Oct 2015 07:28:00 GMT; "+
+		"Max-Age=3600; Secure; HttpOnly; SameSite=None; Partitioned", s)
+
+	// Test: Deleting a cookie
+	s, err = (&Cookie{Name: "id", MaxAge: -1, SameSite: SameSiteLax}).String()
+	require.NoError(t, err)
+	assert.Equal(t, "id=; Max-Age=0; SameSite=Lax", s)
+
+	// Test: Invalid cookies
+	for _, c := range []*Cookie{
+		{Name: "", Value: "x"},
+		{Name: "a b", Value: "x"},
+		{Name: "a;b", Value: "x"},
+		{Name: "a", Value: "x;y"},
+		{Name: "a", Value: "x y"},
+		{Name: "a", Value: "caf\xc3\xa9"},
+		{Name: "a", Path: "/x;Secure"},
+		{Name: "a", Domain: "exa mple.com"},
+		{Name: "a", Domain: "-example.com"},
+		{Name: "a", SameSite: SameSiteNone},
+		{Name: "a", Partitioned: true},
+	} {
+		_, err := c.String()
+		assert.Error(t, err, "%+v", c)
+	}
+}
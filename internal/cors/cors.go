@@ -0,0 +1,238 @@
+// Package cors implements Cross-Origin Resource Sharing.
+package cors
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+type config struct {
+	anyOrigin      bool
+	origins        []string
+	wildcards      [][2]string
+	patterns       []*regexp.Regexp
+	methods        []string
+	headers        []string
+	anyHeader      bool
+	exposedHeaders []string
+	credentials    bool
+	maxAge         time.Duration
+}
+
+type Option func(*config)
+
+// WithOrigins sets the allowed origins. An origin is either "*", an exact
+// origin such as https://example.com, or contains a single "*" standing for
+// any run of host name characters, as in https://*.example.com.
+func WithOrigins(origins ...string) Option {
+	return func(c *config) {
+		for _, o := range origins {
+			switch prefix, suffix, ok := strings.Cut(strings.ToLower(o), "*"); {
+			case o == "*":
+				c.anyOrigin = true
+			case ok:
+				c.wildcards = append(c.wildcards, [2]string{prefix, suffix})
+			default:
+				c.origins = append(c.origins, strings.ToLower(o))
+			}
+		}
+	}
+}
+
+// WithOriginPattern allows origins matching re. Anchor the expression, an
+// unanchored one matches attacker controlled origins that merely contain
+// the allowed one.
+func WithOriginPattern(re *regexp.Regexp) Option {
+	return func(c *config) {
+		c.patterns = append(c.patterns, re)
+	}
+}
+
+// WithMethods sets the methods allowed in cross-origin requests. The
+// default is GET, HEAD and POST.
+func WithMethods(methods ...string) Option {
+	return func(c *config) {
+		c.methods = methods
+	}
+}
+
+// WithHeaders sets the request headers allowed in cross-origin requests.
+// "*" allows any header.
+func WithHeaders(names ...string) Option {
+	return func(c *config) {
+		for _, name := range names {
+			if name == "*" {
+				c.anyHeader = true
+			}
+			c.headers = append(c.headers, strings.ToLower(name))
+		}
+	}
+}
+
+// WithExposedHeaders sets the response headers scripts may read.
+func WithExposedHeaders(names ...string) Option {
+	return func(c *config) {
+		c.exposedHeaders = names
+	}
+}
+
+// WithCredentials allows requests carrying cookies or HTTP authentication.
+// The allowed origin is then always echoed instead of "*".
+func WithCredentials() Option {
+	return func(c *config) {
+		c.credentials = true
+	}
+}
+
+// WithMaxAge sets how long browsers may cache preflight results.
+func WithMaxAge(d time.Duration) Option {
+	return func(c *config) {
+		c.maxAge = d
+	}
+}
+
+// New returns a middleware answering preflight requests and adding CORS
+// headers to responses for allowed origins.
+func New(opts ...Option) server.Middleware {
+	c := &config{
+		methods: []string{"GET", "HEAD", "POST"},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			origin := req.Headers.Get("Origin")
+
+			if req.RequestLine.Method == "OPTIONS" && origin != "" && req.Headers.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, req, origin)
+				return
+			}
+
+			w.OnHeaders(func(_ response.StatusCode, h headers.Headers) {
+				h.AddVary("Origin")
+				if origin == "" || !c.allowed(origin) {
+					return
+				}
+				c.allowOrigin(h, origin)
+				if len(c.exposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(c.exposedHeaders, ", "))
+				}
+			})
+
+			next(w, req)
+		}
+	}
+}
+
+// preflight answers a preflight request with 204. When the origin, method
+// or headers are not allowed the CORS headers are left out, which makes the
+// browser fail the actual request.
+func (c *config) preflight(w *response.Writer, req *request.Request, origin string) {
+	h := headers.NewHeaders()
+	h["Connection"] = "close"
+	h.AddVary("Origin")
+	h.AddVary("Access-Control-Request-Method")
+	h.AddVary("Access-Control-Request-Headers")
+
+	method := req.Headers.Get("Access-Control-Request-Method")
+	requested := splitList(req.Headers.Get("Access-Control-Request-Headers"))
+
+	if c.allowed(origin) && c.methodAllowed(method) && c.headersAllowed(requested) {
+		c.allowOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+		if len(requested) > 0 {
+			// Echoing the request works for "*" with credentials too,
+			// where a literal "*" would not be honored.
+			h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		if c.maxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.maxAge.Seconds())))
+		}
+	}
+
+	w.WriteStatusLine(response.NoContent)
+	w.WriteHeaders(h)
+	w.Writer.Write([]byte("\r\n"))
+}
+
+func (c *config) allowOrigin(h headers.Headers, origin string) {
+	if c.anyOrigin && !c.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *config) allowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	if slices.Contains(c.origins, lower) {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if len(lower) > len(w[0])+len(w[1]) && strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) &&
+			hostChars(lower[len(w[0]):len(lower)-len(w[1])]) {
+			return true
+		}
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostChars reports whether s only holds characters of host names, so that
+// a wildcard cannot swallow a scheme, port or path separator.
+func hostChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if !(ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *config) methodAllowed(method string) bool {
+	return slices.Contains(c.methods, strings.ToUpper(method))
+}
+
+func (c *config) headersAllowed(requested []string) bool {
+	if c.anyHeader {
+		return true
+	}
+	for _, name := range requested {
+		if !slices.Contains(c.headers, name) {
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package cors
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/ratelimit"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+var ok server.Handler = func(w *response.Writer, req *request.Request) {
+	body := "hello"
+	w.WriteStatusLine(response.Ok)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody([]byte(body))
+}
+
+func serve(t *testing.T, handler server.Handler, method string, header ...string) *response.Response {
+	t.Helper()
+	raw := method + " /api HTTP/1.1\r\nHost: localhost:42069\r\n"
+	for _, h := range header {
+		raw += h + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	handler(&response.Writer{Writer: out, State: response.StatusLine}, req)
+	out.WriteString("\r\n")
+
+	r, err := response.ParseFromReader(out)
+	require.NoError(t, err)
+	return r
+}
+
+func TestPreflight(t *testing.T) {
+	handler := New(
+		WithOrigins("https://app.example.com"),
+		WithMethods("GET", "PUT"),
+		WithHeaders("Content-Type", "X-Request-Id"),
+		WithMaxAge(10*time.Minute),
+	)(ok)
+
+	// Test: Allowed preflight
+	r := serve(t, handler, "OPTIONS",
+		"Origin: https://app.example.com",
+		"Access-Control-Request-Method: PUT",
+		"Access-Control-Request-Headers: content-type, x-request-id",
+	)
+	assert.Equal(t, response.NoContent, r.StatusLine.StatusCode)
+	assert.Equal(t, "https://app.example.com", r.Headers.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, PUT", r.Headers.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type, x-request-id", r.Headers.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", r.Headers.Get("Access-Control-Max-Age"))
+	assert.Empty(t, r.Headers.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers", r.Headers.Get("Vary"))
+	assert.Empty(t, r.Body)
+
+	// Test: Refused preflights carry no CORS headers
+	for _, header := range [][]string{
+		{"Origin: https://evil.example.com", "Access-Control-Request-Method: PUT"},
+		{"Origin: https://app.example.com", "Access-Control-Request-Method: DELETE"},
+		{"Origin: https://app.example.com", "Access-Control-Request-Method: PUT", "Access-Control-Request-Headers: x-secret"},
+	} {
+		r = serve(t, handler, "OPTIONS", header...)
+		assert.Equal(t, response.NoContent, r.StatusLine.StatusCode, header)
+		assert.Empty(t, r.Headers.Get("Access-Control-Allow-Origin"), header)
+		assert.Empty(t, r.Headers.Get("Access-Control-Allow-Methods"), header)
+	}
+
+	// Test: Plain OPTIONS reaches the handler
+	r = serve(t, handler, "OPTIONS", "Origin: https://app.example.com")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, "hello", string(r.Body))
+}
+
+func TestActualRequest(t *testing.T) {
+	handler := New(
+		WithOrigins("https://app.example.com"),
+		WithExposedHeaders("X-Request-Id"),
+		WithCredentials(),
+	)(ok)
+
+	// Test: Allowed origin
+	r := serve(t, handler, "GET", "Origin: https://app.example.com")
+	assert.Equal(t, "https://app.example.com", r.Headers.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", r.Headers.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Request-Id", r.Headers.Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", r.Headers.Get("Vary"))
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Other origins are served without CORS headers
+	r = serve(t, handler, "GET", "Origin: https://evil.example.com")
+	assert.Empty(t, r.Headers.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", r.Headers.Get("Vary"))
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Same-origin requests
+	r = serve(t, handler, "GET")
+	assert.Empty(t, r.Headers.Get("Access-Control-Allow-Origin"))
+
+	// Test: Any origin without credentials
+	r = serve(t, New(WithOrigins("*"))(ok), "GET", "Origin: https://whoever.example")
+	assert.Equal(t, "*", r.Headers.Get("Access-Control-Allow-Origin"))
+
+	// Test: Any origin with credentials echoes the origin
+	r = serve(t, New(WithOrigins("*"), WithCredentials())(ok), "GET", "Origin: https://whoever.example")
+	assert.Equal(t, "https://whoever.example", r.Headers.Get("Access-Control-Allow-Origin"))
+
+	// Test: Errors from inner middleware such as a rate limiter are readable
+	limited := server.Chain(ok,
+		New(WithOrigins("https://app.example.com")),
+		ratelimit.New(ratelimit.NewTokenBucket(1, 1)),
+	)
+	serve(t, limited, "GET", "Origin: https://app.example.com")
+	r = serve(t, limited, "GET", "Origin: https://app.example.com")
+	assert.Equal(t, response.TooManyRequests, r.StatusLine.StatusCode)
+	assert.Equal(t, "https://app.example.com", r.Headers.Get("Access-Control-Allow-Origin"))
+}
+
+func TestOriginMatching(t *testing.T) {
+	c := &config{}
+	WithOrigins("https://Exact.example.com", "https://*.example.org")(c)
+	WithOriginPattern(regexp.MustCompile(`^http://localhost:\d+$`))(c)
+
+	for origin, want := range map[string]bool{
+		"https://exact.example.com":      true,
+		"https://exact.example.com.evil": false,
+		"https://a.example.org":          true,
+		"https://a.b.example.org":        true,
+		"https://.example.org":           false,
+		"https://example.org":            false,
+		"http://a.example.org":           false,
+		"https://evil.com/.example.org":  false,
+		"http://localhost:3000":          true,
+		"http://localhost:3000.evil.com": false,
+	} {
+		assert.Equal(t, want, c.allowed(origin), origin)
+	}
+}
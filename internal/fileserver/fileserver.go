@@ -0,0 +1,395 @@
+// Package fileserver serves files from a directory
+package fileserver
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+const (
+	indexFile = "index.html"
+	sniffLen  = 512
+	// timeFormat is the IMF-fixdate format used by Last-Modified.
+	timeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+)
+
+type FileServer struct {
+	root        string
+	stripPrefix string
+	listDirs    bool
+}
+
+type Option func(*FileServer)
+
+// WithStripPrefix removes prefix from the request path before looking up
+// the file.
+func WithStripPrefix(prefix string) Option {
+	return func(fs *FileServer) {
+		fs.stripPrefix = prefix
+	}
+}
+
+// WithoutDirectoryListing answers 403 for directories without an index.html
+// instead of listing their contents.
+func WithoutDirectoryListing() Option {
+	return func(fs *FileServer) {
+		fs.listDirs = false
+	}
+}
+
+func New(root string, opts ...Option) *FileServer {
+	fs := &FileServer{
+		root:     root,
+		listDirs: true,
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+
+	return fs
+}
+
+// Handle serves the file named by the request target. It has the signature
+// of server.Handler.
+func (fs *FileServer) Handle(w *response.Writer, req *request.Request) {
+	target, err := url.ParseRequestURI(req.RequestLine.RequestTarget)
+	if err != nil {
+		writeError(w, response.BadRequest)
+		return
+	}
+
+	urlPath := target.Path
+	if fs.stripPrefix != "" {
+		trimmed, ok := strings.CutPrefix(urlPath, fs.stripPrefix)
+		if !ok {
+			writeError(w, response.NotFound)
+			return
+		}
+		urlPath = trimmed
+	}
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+
+	fs.serve(w, req, urlPath, target.Path)
+}
+
+// ServeFile serves name, a slash separated path relative to the root,
+// regardless of the request target.
+func (fs *FileServer) ServeFile(w *response.Writer, req *request.Request, name string) {
+	fs.serve(w, req, "/"+strings.TrimPrefix(name, "/"), "")
+}
+
+func (fs *FileServer) serve(w *response.Writer, req *request.Request, urlPath, fullPath string) {
+	method := req.RequestLine.Method
+	if method != "GET" && method != "HEAD" {
+		hdrs := headers.NewHeaders()
+		hdrs["Allow"] = "GET, HEAD"
+		writeErrorHeaders(w, response.MethodNotAllowed, hdrs)
+		return
+	}
+
+	name, ok := cleanPath(urlPath)
+	if !ok {
+		writeError(w, response.NotFound)
+		return
+	}
+
+	root, err := os.OpenRoot(fs.root)
+	if err != nil {
+		writeError(w, response.InternalError)
+		return
+	}
+	defer root.Close()
+
+	f, err := root.Open(name)
+	if err != nil {
+		writeError(w, statusForError(err))
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, statusForError(err))
+		return
+	}
+
+	if info.IsDir() {
+		// Relative links in an index page only resolve with a trailing
+		// slash, so redirect to it first.
+		if fullPath != "" && !strings.HasSuffix(fullPath, "/") {
+			hdrs := headers.NewHeaders()
+			hdrs["Location"] = path.Base(fullPath) + "/"
+			writeErrorHeaders(w, response.MovedPermanently, hdrs)
+			return
+		}
+
+		index, err := root.Open(path.Join(name, indexFile))
+		if err == nil {
+			defer index.Close()
+			indexInfo, err := index.Stat()
+			if err == nil && indexInfo.Mode().IsRegular() {
+				serveContent(w, req, index, indexInfo)
+				return
+			}
+		}
+
+		if !fs.listDirs {
+			writeError(w, response.Forbidden)
+			return
+		}
+		serveDirectory(w, req, f)
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		writeError(w, response.NotFound)
+		return
+	}
+
+	serveContent(w, req, f, info)
+}
+
+// cleanPath turns a URL path into a name usable with os.Root. It rejects
+// paths that try to climb out of the root.
+func cleanPath(urlPath string) (string, bool) {
+	if strings.ContainsRune(urlPath, 0) || strings.Contains(urlPath, "\\") {
+		return "", false
+	}
+	for _, segment := range strings.Split(urlPath, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+
+	name := strings.TrimPrefix(path.Clean(urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", false
+	}
+
+	return name, true
+}
+
+func serveContent(w *response.Writer, req *request.Request, f *os.File, info fs.FileInfo) {
+	modTime := info.ModTime().UTC().Truncate(time.Second)
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+
+	hdrs := headers.NewHeaders()
+	hdrs["ETag"] = etag
+	hdrs["Last-Modified"] = modTime.Format(timeFormat)
+	hdrs["Accept-Ranges"] = "bytes"
+
+	if notModified(req, etag, modTime) {
+		hdrs["Connection"] = "close"
+		w.WriteStatusLine(response.NotModified)
+		w.WriteHeaders(hdrs)
+		w.Writer.Write([]byte("\r\n"))
+		return
+	}
+
+	contentType, err := detectContentType(f)
+	if err != nil {
+		writeError(w, response.InternalError)
+		return
+	}
+
+	size := info.Size()
+	ranges, err := parseRange(req.Headers.Get("Range"), size)
+	if err != nil {
+		hdrs["Content-Range"] = fmt.Sprintf("bytes */%d", size)
+		writeErrorHeaders(w, response.RangeNotSatisfiable, hdrs)
+		return
+	}
+	if !rangeApplies(req, etag, modTime) {
+		ranges = nil
+	}
+
+	body := req.RequestLine.Method != "HEAD"
+	switch len(ranges) {
+	case 0:
+		writeHead(w, response.Ok, hdrs, size, contentType)
+		if body {
+			w.ReadFrom(io.LimitReader(f, size))
+		}
+
+	case 1:
+		ra := ranges[0]
+		hdrs["Content-Range"] = ra.contentRange(size)
+		writeHead(w, response.PartialContent, hdrs, ra.length, contentType)
+		if body {
+			copyRange(w, f, ra)
+		}
+
+	default:
+		mr := newMultipartRanges(ranges, contentType, size)
+		writeHead(w, response.PartialContent, hdrs, mr.length(), mr.contentType())
+		if body {
+			mr.write(w, f)
+		}
+	}
+}
+
+func writeHead(w *response.Writer, status response.StatusCode, hdrs headers.Headers, length int64, contentType string) {
+	for k, v := range response.GetDefaultHeaders(int(length), contentType, false) {
+		hdrs[k] = v
+	}
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(hdrs)
+	w.Writer.Write([]byte("\r\n"))
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since as
+// RFC 9110 section 13.2.2 describes.
+func notModified(req *request.Request, etag string, modTime time.Time) bool {
+	if inm := req.Headers.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag, true)
+	}
+
+	ims := req.Headers.Get("If-Modified-Since")
+	if ims == "" {
+		return false
+	}
+	t, err := time.Parse(timeFormat, ims)
+	if err != nil {
+		return false
+	}
+	return !modTime.After(t)
+}
+
+// rangeApplies evaluates If-Range. A range request whose validator no
+// longer matches gets the whole file.
+func rangeApplies(req *request.Request, etag string, modTime time.Time) bool {
+	ir := req.Headers.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) {
+		return ir == etag
+	}
+	t, err := time.Parse(timeFormat, ir)
+	return err == nil && modTime.Equal(t)
+}
+
+func etagMatches(list, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func detectContentType(f *os.File) (string, error) {
+	if ctype := mime.TypeByExtension(filepath.Ext(f.Name())); ctype != "" {
+		return ctype, nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return sniff(buf[:n]), nil
+}
+
+// sniff is a much smaller cousin of the WHATWG sniffing algorithm. It only
+// tells text from binary data.
+func sniff(data []byte) string {
+	if !utf8.Valid(data) {
+		return "application/octet-stream"
+	}
+	for _, b := range data {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' {
+			return "application/octet-stream"
+		}
+	}
+	return "text/plain; charset=utf-8"
+}
+
+func serveDirectory(w *response.Writer, req *request.Request, dir *os.File) {
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		writeError(w, response.InternalError)
+		return
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	var b strings.Builder
+	b.WriteString("<html>\n  <body>\n    <ul>\n")
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		link := (&url.URL{Path: name}).String()
+		fmt.Fprintf(&b, "      <li><a href=\"%s\">%s</a></li>\n", html.EscapeString(link), html.EscapeString(name))
+	}
+	b.WriteString("    </ul>\n  </body>\n</html>\n")
+
+	listing := b.String()
+	writeHead(w, response.Ok, headers.NewHeaders(), int64(len(listing)), "text/html; charset=utf-8")
+	if req.RequestLine.Method != "HEAD" {
+		w.WriteBody([]byte(listing))
+	}
+}
+
+func statusForError(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return response.NotFound
+	case errors.Is(err, fs.ErrPermission):
+		return response.Forbidden
+	default:
+		// os.Root reports attempts to escape through symlinks as generic
+		// path errors; those are simply not found from the client's view.
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return response.NotFound
+		}
+		return response.InternalError
+	}
+}
+
+func writeError(w *response.Writer, status response.StatusCode) {
+	writeErrorHeaders(w, status, headers.NewHeaders())
+}
+
+func writeErrorHeaders(w *response.Writer, status response.StatusCode, hdrs headers.Headers) {
+	body := fmt.Sprintf("%d %s\n", status, response.StatusText(status))
+	writeHead(w, status, hdrs, int64(len(body)), "text/plain")
+	w.WriteBody([]byte(body))
+}
@@ -0,0 +1,239 @@
+package fileserver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+const content = "0123456789abcdefghij"
+
+func TestServeFile(t *testing.T) {
+	fs := New(newRoot(t))
+
+	// Test: Whole file
+	r := get(t, fs, "GET /file.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", r.Headers.Get("Content-Type"))
+	assert.Equal(t, fmt.Sprint(len(content)), r.Headers.Get("Content-Length"))
+	assert.Equal(t, "bytes", r.Headers.Get("Accept-Ranges"))
+	assert.NotEmpty(t, r.Headers.Get("ETag"))
+	assert.NotEmpty(t, r.Headers.Get("Last-Modified"))
+	assert.Equal(t, content, string(r.Body))
+
+	// Test: Sniffed content type
+	r = get(t, fs, "GET /noext HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "application/octet-stream", r.Headers.Get("Content-Type"))
+
+	// Test: HEAD has headers but no body
+	out := serve(t, fs, "HEAD /file.txt HTTP/1.1\r\n\r\n")
+	assert.Contains(t, out, "Content-Length: 20\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"))
+
+	// Test: Missing file and unsupported method
+	r = get(t, fs, "GET /missing HTTP/1.1\r\n\r\n")
+	assert.Equal(t, response.NotFound, r.StatusLine.StatusCode)
+	r = get(t, fs, "POST /file.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, response.MethodNotAllowed, r.StatusLine.StatusCode)
+	assert.Equal(t, "GET, HEAD", r.Headers.Get("Allow"))
+}
+
+func TestPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "public")
+	require.NoError(t, os.Mkdir(root, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "link")))
+
+	fs := New(root)
+	for _, target := range []string{
+		"/../secret",
+		"/%2e%2e/secret",
+		"/a/../../secret",
+		"/..%2fsecret",
+		"/%5c..%5csecret",
+		"/link",
+	} {
+		r := get(t, fs, "GET "+target+" HTTP/1.1\r\n\r\n")
+		assert.Equal(t, response.NotFound, r.StatusLine.StatusCode, target)
+		assert.NotContains(t, string(r.Body), "secret", target)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	fs := New(newRoot(t))
+	r := get(t, fs, "GET /file.txt HTTP/1.1\r\n\r\n")
+	etag := r.Headers.Get("ETag")
+	lastModified := r.Headers.Get("Last-Modified")
+
+	// Test: Matching ETag
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nIf-None-Match: \"other\", "+etag+"\r\n\r\n")
+	assert.Equal(t, response.NotModified, r.StatusLine.StatusCode)
+	assert.Empty(t, r.Body)
+
+	// Test: Weak comparison
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nIf-None-Match: W/"+etag+"\r\n\r\n")
+	assert.Equal(t, response.NotModified, r.StatusLine.StatusCode)
+
+	// Test: Non-matching ETag wins over If-Modified-Since
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nIf-None-Match: \"other\"\r\nIf-Modified-Since: "+lastModified+"\r\n\r\n")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+
+	// Test: Not modified since
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nIf-Modified-Since: "+lastModified+"\r\n\r\n")
+	assert.Equal(t, response.NotModified, r.StatusLine.StatusCode)
+
+	// Test: Modified since
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nIf-Modified-Since: Mon, 02 Jan 2006 15:04:05 GMT\r\n\r\n")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+}
+
+func TestRangeRequests(t *testing.T) {
+	fs := New(newRoot(t))
+
+	// Test: Single ranges
+	for header, want := range map[string]string{
+		"bytes=0-4":   "01234",
+		"bytes=15-":   "fghij",
+		"bytes=-3":    "hij",
+		"bytes=18-99": "ij",
+	} {
+		r := get(t, fs, "GET /file.txt HTTP/1.1\r\nRange: "+header+"\r\n\r\n")
+		assert.Equal(t, response.PartialContent, r.StatusLine.StatusCode, header)
+		assert.Equal(t, want, string(r.Body), header)
+	}
+	r := get(t, fs, "GET /file.txt HTTP/1.1\r\nRange: bytes=2-5\r\n\r\n")
+	assert.Equal(t, "bytes 2-5/20", r.Headers.Get("Content-Range"))
+
+	// Test: Multiple ranges
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nRange: bytes=0-1, 10-12\r\n\r\n")
+	assert.Equal(t, response.PartialContent, r.StatusLine.StatusCode)
+	mediaType, params, err := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+	assert.Equal(t, fmt.Sprint(len(r.Body)), r.Headers.Get("Content-Length"))
+
+	mr := multipart.NewReader(bytes.NewReader(r.Body), params["boundary"])
+	parts := map[string]string{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(part)
+		require.NoError(t, err)
+		parts[part.Header.Get("Content-Range")] = string(data)
+	}
+	assert.Equal(t, map[string]string{"bytes 0-1/20": "01", "bytes 10-12/20": "abc"}, parts)
+
+	// Test: Unsatisfiable range
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nRange: bytes=50-60\r\n\r\n")
+	assert.Equal(t, response.RangeNotSatisfiable, r.StatusLine.StatusCode)
+	assert.Equal(t, "bytes */20", r.Headers.Get("Content-Range"))
+
+	// Test: Overlapping and adjacent ranges are merged
+	for header, want := range map[string]string{
+		"bytes=0-,0-,0-":       "bytes 0-19/20",
+		"bytes=0-4, 5-9":       "bytes 0-9/20",
+		"bytes=10-14, 2-11":    "bytes 2-14/20",
+		"bytes=-5, 15-, 16-17": "bytes 15-19/20",
+	} {
+		r = get(t, fs, "GET /file.txt HTTP/1.1\r\nRange: "+header+"\r\n\r\n")
+		assert.Equal(t, response.PartialContent, r.StatusLine.StatusCode, header)
+		assert.Equal(t, want, r.Headers.Get("Content-Range"), header)
+	}
+
+	// Test: Malformed range is ignored
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nRange: bytes=5-2\r\n\r\n")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, content, string(r.Body))
+
+	// Test: Stale If-Range serves the whole file
+	r = get(t, fs, "GET /file.txt HTTP/1.1\r\nRange: bytes=0-1\r\nIf-Range: \"stale\"\r\n\r\n")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+}
+
+func TestRangeEmptyFile(t *testing.T) {
+	root := newRoot(t)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "empty.txt"), nil, 0o644))
+	fs := New(root)
+
+	// Test: No range of an empty file is satisfiable
+	for _, header := range []string{"bytes=-5", "bytes=0-", "bytes=0-0", "bytes=-5, 0-"} {
+		r := get(t, fs, "GET /empty.txt HTTP/1.1\r\nRange: "+header+"\r\n\r\n")
+		assert.Equal(t, response.RangeNotSatisfiable, r.StatusLine.StatusCode, header)
+		assert.Equal(t, "bytes */0", r.Headers.Get("Content-Range"), header)
+	}
+}
+
+func TestDirectories(t *testing.T) {
+	root := newRoot(t)
+	require.NoError(t, os.Mkdir(filepath.Join(root, "site"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "site", "index.html"), []byte("<p>home</p>"), 0o644))
+
+	fs := New(root)
+
+	// Test: Listing
+	r := get(t, fs, "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Contains(t, string(r.Body), `<a href="file.txt">file.txt</a>`)
+	assert.Contains(t, string(r.Body), `<a href="site/">site/</a>`)
+	assert.Contains(t, string(r.Body), `&lt;b&gt;.txt`)
+
+	// Test: Index page
+	r = get(t, fs, "GET /site/ HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "<p>home</p>", string(r.Body))
+	assert.Equal(t, "text/html; charset=utf-8", r.Headers.Get("Content-Type"))
+
+	// Test: Redirect to trailing slash
+	r = get(t, fs, "GET /site HTTP/1.1\r\n\r\n")
+	assert.Equal(t, response.MovedPermanently, r.StatusLine.StatusCode)
+	assert.Equal(t, "site/", r.Headers.Get("Location"))
+
+	// Test: Listing disabled
+	r = get(t, New(root, WithoutDirectoryListing()), "GET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, response.Forbidden, r.StatusLine.StatusCode)
+
+	// Test: Prefix stripping
+	r = get(t, New(root, WithStripPrefix("/static")), "GET /static/file.txt HTTP/1.1\r\n\r\n")
+	assert.Equal(t, content, string(r.Body))
+}
+
+func newRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte(content), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "noext"), []byte{0, 1, 2, 3}, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "<b>.txt"), nil, 0o644))
+	return root
+}
+
+func serve(t *testing.T, fs *FileServer, raw string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	fs.Handle(&response.Writer{Writer: out, State: response.StatusLine}, req)
+	return out.String()
+}
+
+func get(t *testing.T, fs *FileServer, raw string) *response.Response {
+	t.Helper()
+	r, err := response.ParseFromReader(strings.NewReader(serve(t, fs, raw)))
+	require.NoError(t, err)
+	return r
+}
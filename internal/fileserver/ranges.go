@@ -0,0 +1,174 @@
+package fileserver
+
+import (
+	"cmp"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"httpFromTcp/internal/response"
+)
+
+// maxRanges bounds the work a single request can ask for.
+const maxRanges = 32
+
+var errUnsatisfiable = errors.New("range not satisfiable")
+
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses a Range header (RFC 9110 section 14.1.2). Headers it does
+// not understand are ignored by returning no ranges, as the RFC allows; only
+// syntactically valid ranges that all miss the file are an error.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, nil
+		}
+
+		var r byteRange
+		if first == "" {
+			// Suffix range: the final n bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			n = min(n, size)
+			if n == 0 {
+				continue
+			}
+			r = byteRange{size - n, n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+				end = min(end, size-1)
+			}
+			if start >= size {
+				continue
+			}
+			r = byteRange{start, end - start + 1}
+		}
+
+		ranges = append(ranges, r)
+		if len(ranges) > maxRanges {
+			return nil, nil
+		}
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiable
+	}
+	return coalesce(ranges), nil
+}
+
+// coalesce sorts ranges and merges those that overlap or touch, so that
+// repeating a range cannot multiply the size of the response.
+func coalesce(ranges []byteRange) []byteRange {
+	slices.SortFunc(ranges, func(a, b byteRange) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.start <= last.start+last.length {
+			last.length = max(last.length, r.start+r.length-last.start)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// copyRange sends a section of f. The limited reader keeps the copy
+// eligible for sendfile when w writes to a TCP connection.
+func copyRange(w *response.Writer, f *os.File, r byteRange) error {
+	if _, err := f.Seek(r.start, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := w.ReadFrom(io.LimitReader(f, r.length))
+	return err
+}
+
+// multipartRanges writes a multipart/byteranges body (RFC 9110 section
+// 14.6).
+type multipartRanges struct {
+	ranges   []byteRange
+	boundary string
+	headers  []string
+}
+
+func newMultipartRanges(ranges []byteRange, contentType string, size int64) *multipartRanges {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	mr := &multipartRanges{
+		ranges:   ranges,
+		boundary: fmt.Sprintf("%x", b),
+	}
+	for _, r := range ranges {
+		mr.headers = append(mr.headers, fmt.Sprintf("\r\n--%s\r\nContent-Type: %s\r\nContent-Range: %s\r\n\r\n",
+			mr.boundary, contentType, r.contentRange(size)))
+	}
+
+	return mr
+}
+
+func (mr *multipartRanges) contentType() string {
+	return "multipart/byteranges; boundary=" + mr.boundary
+}
+
+func (mr *multipartRanges) closing() string {
+	return "\r\n--" + mr.boundary + "--\r\n"
+}
+
+func (mr *multipartRanges) length() int64 {
+	n := int64(len(mr.closing()))
+	for i, r := range mr.ranges {
+		n += int64(len(mr.headers[i])) + r.length
+	}
+	return n
+}
+
+func (mr *multipartRanges) write(w *response.Writer, f *os.File) error {
+	for i, r := range mr.ranges {
+		if _, err := w.WriteBody([]byte(mr.headers[i])); err != nil {
+			return err
+		}
+		if err := copyRange(w, f, r); err != nil {
+			return err
+		}
+	}
+	_, err := w.WriteBody([]byte(mr.closing()))
+	return err
+}
@@ -0,0 +1,92 @@
+package headers_test
+
+import (
+	"bytes"
+	"maps"
+	"strings"
+	"testing"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/response"
+)
+
+// FuzzHeadersParse feeds a header block line by line and checks that
+// parsing never panics, only consumes whole lines, keeps nothing larger than
+// the input, and that writing the parsed headers back out with
+// response.Writer and parsing them again gives the same result.
+func FuzzHeadersParse(f *testing.F) {
+	for _, seed := range []string{
+		"Host: localhost:42069\r\n\r\n",
+		"Host: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+		"       Host: localhost:42069       \r\n\r\n",
+		"       Host : localhost:42069       \r\n\r\n",
+		"H©st: localhost:42069\r\n\r\n",
+		"Accept: text/html\r\nAccept: text/json\r\n\r\n",
+		"no colon\r\n\r\n",
+		": empty name\r\n\r\n",
+		"X-Empty:\r\nX-Empty:\r\n\r\n",
+		"X-Folded: a\r\n b\r\n\r\n",
+		"X-Bare-LF: a\nb\r\n\r\n",
+		"\r\n",
+		"Host: unterminated",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h, done := parseAll(t, data)
+
+		size := 0
+		for k, v := range h {
+			size += len(k) + len(v)
+			if k != strings.ToLower(k) {
+				t.Fatalf("name %q is not lowercase", k)
+			}
+			if strings.Contains(v, "\r\n") {
+				t.Fatalf("value %q contains a line break", v)
+			}
+		}
+		if size > len(data) {
+			t.Fatalf("parsed %d bytes out of %d bytes of input", size, len(data))
+		}
+
+		if !done {
+			return
+		}
+		var out bytes.Buffer
+		w := &response.Writer{Writer: &out, State: response.Headers}
+		if err := w.WriteHeaders(h); err != nil {
+			t.Fatal(err)
+		}
+		out.WriteString("\r\n")
+		again, done := parseAll(t, out.Bytes())
+		// Whitespace around a value cannot be written back, and a value
+		// joined from an empty repeat can end in one.
+		want := maps.Clone(h)
+		for k, v := range want {
+			want[k] = strings.Trim(v, " \t")
+		}
+		if !done || !maps.Equal(want, again) {
+			t.Fatalf("round trip changed headers: %q, then %q", h, again)
+		}
+	})
+}
+
+// parseAll parses data until the end of the header block, an error or the
+// end of the data.
+func parseAll(t *testing.T, data []byte) (headers.Headers, bool) {
+	h := headers.NewHeaders()
+	for {
+		n, done, err := h.Parse(data)
+		if err != nil || n == 0 {
+			return h, false
+		}
+		if n > len(data) || !bytes.HasSuffix(data[:n], []byte("\r\n")) {
+			t.Fatalf("consumed %d bytes of %q", n, data)
+		}
+		if done {
+			return h, true
+		}
+		data = data[n:]
+	}
+}
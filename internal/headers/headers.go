@@ -2,57 +2,188 @@
 package headers
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"regexp"
 	"strings"
 )
 
 type Headers map[string]string
 
+// ErrMalformedHeader is wrapped by every error Parse returns.
+var ErrMalformedHeader = errors.New("malformed header")
+
 func (h Headers) Get(key string) string {
-	return h[strings.ToLower(key)]
+	key = strings.ToLower(key)
+	if v, ok := h[key]; ok {
+		return v
+	}
+	// Headers built in code may use canonical casing for their keys.
+	for k, v := range h {
+		if strings.ToLower(k) == key {
+			return v
+		}
+	}
+	return ""
 }
 
-const crfl = "\r\n"
+// Set replaces any value stored under key, whatever its casing.
+func (h Headers) Set(key, value string) {
+	h.Del(key)
+	h[strings.ToLower(key)] = value
+}
+
+// Del removes key, whatever its casing.
+func (h Headers) Del(key string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
+}
+
+// AddVary adds field to the Vary header unless it is already listed.
+func (h Headers) AddVary(field string) {
+	vary := h.Get("Vary")
+	for _, v := range strings.Split(vary, ",") {
+		if v = strings.TrimSpace(v); v == "*" || strings.EqualFold(v, field) {
+			return
+		}
+	}
+	if vary == "" {
+		h.Set("Vary", field)
+	} else {
+		h.Set("Vary", vary+", "+field)
+	}
+}
+
+var crlf = []byte("\r\n")
 
 func NewHeaders() Headers {
 	return Headers{}
 }
 
 func (h Headers) Parse(data []byte) (n int, done bool, err error) {
-	validCharacters, err := regexp.Compile("^[A-Za-z0-9!#$%&'*+-.^_`|~]+$")
-	if err != nil {
-		return 0, false, fmt.Errorf("regexp is invalid")
-	}
-
-	endlineIndex := strings.Index(string(data), crfl)
+	endlineIndex := bytes.Index(data, crlf)
 	if endlineIndex == -1 {
 		return 0, false, nil
 	}
-
-	if string(data[0:len(crfl)]) == crfl {
-		return len(crfl), true, nil
+	if endlineIndex == 0 {
+		return len(crlf), true, nil
 	}
 
-	trimmedData := strings.Trim(string(data[:endlineIndex]), " ")
-	firstSemi := strings.Index(trimmedData, ":")
-	key := strings.ToLower(trimmedData[:firstSemi])
-	value := strings.Trim(trimmedData[firstSemi+1:], " ")
-
-	if !validCharacters.MatchString(key) {
-		return 0, false, fmt.Errorf("header key contains invalid characters: %s", key)
+	line := trimSpaces(data[:endlineIndex])
+	// A bare CR or LF is a line break to some parsers and not to others,
+	// which lets a request smuggle headers past a proxy.
+	if bytes.ContainsAny(line, "\r\n\x00") {
+		return 0, false, fmt.Errorf("%w, contains CR, LF or NUL: %q", ErrMalformedHeader, line)
+	}
+	colon := bytes.IndexByte(line, ':')
+	if colon == -1 {
+		return 0, false, fmt.Errorf("%w, missing colon: %q", ErrMalformedHeader, line)
 	}
 
-	if strings.Contains(key, " ") {
-		return 0, false, fmt.Errorf("malformed header, invalid whitespace, data: %s, key: %s, value: %s", trimmedData, key, value)
+	name := line[:colon]
+	if len(name) == 0 {
+		return 0, false, fmt.Errorf("%w, empty name", ErrMalformedHeader)
+	}
+	for _, c := range name {
+		if !tokenChars[c] {
+			return 0, false, fmt.Errorf("%w, name contains invalid characters: %q", ErrMalformedHeader, name)
+		}
 	}
 
-	if h[key] != "" {
-		h[key] = h[key] + ", " + value
+	key := internName(name)
+	value := string(trimSpaces(line[colon+1:]))
+
+	// Repeats are joined even after an empty value, so a duplicated
+	// Content-Length or Host stays visible to the framing checks.
+	if prev, ok := h[key]; ok {
+		h[key] = prev + ", " + value
 	} else {
 		h[key] = value
 	}
 
-	consumedData := len(data[:endlineIndex]) + len(crfl)
-	return consumedData, false, nil
+	return endlineIndex + len(crlf), false, nil
+}
+
+// tokenChars marks the bytes allowed in a token such as a header name, per
+// RFC 9110 section 5.6.2.
+var tokenChars = func() [256]bool {
+	var t [256]bool
+	for c := '0'; c <= '9'; c++ {
+		t[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		t[c] = true
+		t[c-'a'+'A'] = true
+	}
+	for _, c := range "!#$%&'*+-.^_`|~" {
+		t[c] = true
+	}
+	return t
+}()
+
+// IsToken reports whether s is a non-empty token.
+func IsToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !tokenChars[s[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// commonNames are returned for matching header names so parsing them does
+// not allocate.
+var commonNames = func() map[string]string {
+	m := map[string]string{}
+	for _, name := range []string{
+		"accept", "accept-encoding", "accept-language", "authorization",
+		"cache-control", "connection", "content-encoding", "content-length",
+		"content-type", "cookie", "date", "expect", "forwarded", "host",
+		"if-modified-since", "if-none-match", "if-range", "origin", "range",
+		"referer", "te", "traceparent", "tracestate", "transfer-encoding",
+		"upgrade", "user-agent", "x-forwarded-for", "x-forwarded-host",
+		"x-forwarded-proto", "x-request-id",
+	} {
+		m[name] = name
+	}
+	return m
+}()
+
+const maxInternedName = 32
+
+// internName returns name lowercased, without allocating for common names.
+func internName(name []byte) string {
+	if len(name) > maxInternedName {
+		return string(bytes.ToLower(name))
+	}
+
+	var buf [maxInternedName]byte
+	lower := buf[:len(name)]
+	for i, c := range name {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	if s, ok := commonNames[string(lower)]; ok {
+		return s
+	}
+	return string(lower)
+}
+
+// trimSpaces strips optional whitespace, spaces and tabs, around b.
+func trimSpaces(b []byte) []byte {
+	for len(b) > 0 && (b[0] == ' ' || b[0] == '\t') {
+		b = b[1:]
+	}
+	for len(b) > 0 && (b[len(b)-1] == ' ' || b[len(b)-1] == '\t') {
+		b = b[:len(b)-1]
+	}
+	return b
 }
@@ -59,6 +59,18 @@ func TestHeadersParse(t *testing.T) {
 	assert.Equal(t, 21, n)
 	assert.False(t, done)
 
+	// Test: Repeats after an empty value are still appended
+	headers = map[string]string{"content-length": ""}
+	_, _, err = headers.Parse([]byte("Content-Length: 5\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, ", 5", headers["content-length"])
+
+	// Test: Tabs are optional whitespace too
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("Content-Length:\t5 \t\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "5", headers["content-length"])
+
 	// Test: Invalid spacing header
 	headers = NewHeaders()
 	data = []byte("       Host : localhost:42069       \r\n\r\n")
@@ -74,4 +86,59 @@ func TestHeadersParse(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
+
+	// Test: Missing colon
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("Host localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Empty name
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte(": localhost:42069\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Bare LF, bare CR and NUL
+	for _, line := range []string{"X-A: a\nb\r\n", "X-A: a\rb\r\n", "X-A: a\x00b\r\n", "X-A\n: a\r\n"} {
+		headers = NewHeaders()
+		_, _, err = headers.Parse([]byte(line))
+		require.Error(t, err, line)
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	h := Headers{"Vary": "accept-encoding"}
+	h.AddVary("Origin")
+	assert.Equal(t, "accept-encoding, Origin", h.Get("Vary"))
+
+	// Test: Already listed
+	h.AddVary("Accept-Encoding")
+	assert.Equal(t, "accept-encoding, Origin", h.Get("Vary"))
+
+	// Test: Wildcard covers everything
+	h = Headers{"vary": "*"}
+	h.AddVary("Origin")
+	assert.Equal(t, "*", h.Get("Vary"))
+}
+
+func BenchmarkParse(b *testing.B) {
+	lines := [][]byte{
+		[]byte("Host: localhost:42069\r\n"),
+		[]byte("User-Agent: curl/7.81.0\r\n"),
+		[]byte("Accept: */*\r\n"),
+		[]byte("X-Custom-Header: some value\r\n"),
+	}
+	run := func(b *testing.B, parse func(Headers, []byte) (int, bool, error)) {
+		b.ReportAllocs()
+		for b.Loop() {
+			h := NewHeaders()
+			for _, line := range lines {
+				if _, _, err := parse(h, line); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+
+	b.Run("bytes", func(b *testing.B) { run(b, Headers.Parse) })
+	b.Run("legacy", func(b *testing.B) { run(b, Headers.legacyParse) })
 }
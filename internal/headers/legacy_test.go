@@ -0,0 +1,126 @@
+package headers
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// legacyParse is the regexp based parser Parse replaced, kept as the
+// reference for FuzzParseEquivalence. It panics on lines without a colon.
+func (h Headers) legacyParse(data []byte) (n int, done bool, err error) {
+	validCharacters, err := regexp.Compile("^[A-Za-z0-9!#$%&'*+-.^_`|~]+$")
+	if err != nil {
+		return 0, false, fmt.Errorf("regexp is invalid")
+	}
+
+	endlineIndex := strings.Index(string(data), "\r\n")
+	if endlineIndex == -1 {
+		return 0, false, nil
+	}
+
+	if string(data[0:len(crlf)]) == "\r\n" {
+		return len(crlf), true, nil
+	}
+
+	trimmedData := strings.Trim(string(data[:endlineIndex]), " ")
+	firstSemi := strings.Index(trimmedData, ":")
+	key := strings.ToLower(trimmedData[:firstSemi])
+	value := strings.Trim(trimmedData[firstSemi+1:], " ")
+
+	if !validCharacters.MatchString(key) {
+		return 0, false, fmt.Errorf("header key contains invalid characters: %s", key)
+	}
+
+	if strings.Contains(key, " ") {
+		return 0, false, fmt.Errorf("malformed header, invalid whitespace, data: %s, key: %s, value: %s", trimmedData, key, value)
+	}
+
+	if h[key] != "" {
+		h[key] = h[key] + ", " + value
+	} else {
+		h[key] = value
+	}
+
+	consumedData := len(data[:endlineIndex]) + len(crlf)
+	return consumedData, false, nil
+}
+
+func FuzzParseEquivalence(f *testing.F) {
+	for _, seed := range []string{
+		"Host: localhost:42069\r\n\r\n",
+		"       Host: localhost:42069       \r\n\r\n",
+		"       Host : localhost:42069       \r\n\r\n",
+		"H©st: localhost:42069\r\n\r\n",
+		"Accept: text/html  \r\n\r\n",
+		"Content-Length: 5\r\nContent-Length: 6\r\n\r\n",
+		"X-Empty:\r\n",
+		": no name\r\n",
+		"\r\n",
+		"partial",
+		"no colon\r\n",
+		"Set-Cookie: a=b; Path=/\r\n",
+		"X-Very-Long-Header-Name-That-Is-Not-Interned-At-All: v\r\n",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Both parsers append to repeated names, so start from the same
+		// non-empty state to cover that path too.
+		got, want := Headers{"host": "a"}, Headers{"host": "a"}
+
+		n, done, err := got.Parse(data)
+
+		wantN, wantDone, wantErr, panicked := func() (n int, done bool, err error, panicked bool) {
+			defer func() {
+				if recover() != nil {
+					panicked = true
+				}
+			}()
+			n, done, err = want.legacyParse(data)
+			return
+		}()
+
+		if panicked {
+			// The old parser panicked on lines without a colon.
+			if err == nil {
+				t.Fatalf("legacy parser panicked but Parse accepted %q", data)
+			}
+			return
+		}
+
+		if err != nil && wantErr == nil {
+			// The old parser's pattern accidentally accepted commas in
+			// names, and it lowercased before validating, which turns some
+			// non-ASCII letters such as the Kelvin sign into ASCII.
+			name, _, _ := bytes.Cut(data, []byte(":"))
+			if bytes.ContainsRune(name, ',') || slices.ContainsFunc([]rune(string(name)), func(r rune) bool { return r >= utf8.RuneSelf }) {
+				return
+			}
+			// Lines with a bare CR or LF, or a NUL, are rejected now.
+			line, _, _ := bytes.Cut(data, crlf)
+			if bytes.ContainsAny(line, "\r\n\x00") {
+				return
+			}
+		}
+
+		if (err != nil) != (wantErr != nil) {
+			t.Fatalf("input %q: err = %v, legacy err = %v", data, err, wantErr)
+		}
+		if err != nil {
+			return
+		}
+		if n != wantN || done != wantDone {
+			t.Fatalf("input %q: got (%d, %v), legacy (%d, %v)", data, n, done, wantN, wantDone)
+		}
+		if !maps.Equal(got, want) {
+			t.Fatalf("input %q: got %q, legacy %q", data, got, want)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultReloadInterval = time.Second
+
+// Key is a verification key from a JWK set.
+type Key struct {
+	ID string
+	// Algorithm restricts the key to one algorithm when the JWK names one.
+	Algorithm string
+	// Public is an *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey, or
+	// the []byte secret of an HMAC key.
+	Public any
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses a JSON Web Key Set. Keys of unsupported types are
+// skipped and keys meant for encryption are ignored.
+func ParseJWKS(data []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make([]Key, 0, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public, err := k.public()
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%s): %w", i, k.Kid, err)
+		}
+		if public == nil {
+			continue
+		}
+		keys = append(keys, Key{ID: k.Kid, Algorithm: k.Alg, Public: public})
+	}
+
+	return keys, nil
+}
+
+func (k jwk) public() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key is shorter than 2048 bits")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeFixed(k.X, 32)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeFixed(k.Y, 32)
+		if err != nil {
+			return nil, err
+		}
+		// ecdh rejects points that are not on the curve.
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := decodeFixed(k.X, ed25519.PublicKeySize)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid secret")
+		}
+		return secret, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func decodeFixed(s string, size int) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != size {
+		return nil, fmt.Errorf("invalid coordinate")
+	}
+	return b, nil
+}
+
+// KeyFile is a JWK set read from a local file. The file is checked for
+// changes at most once per second and reloaded when its size or
+// modification time changes, so keys can be rotated without a restart. If
+// a reload fails the previous keys stay in use; the failure is logged with
+// slog.Default() and reported by Err until a reload succeeds.
+type KeyFile struct {
+	path     string
+	interval time.Duration
+
+	mu        sync.Mutex
+	keys      []Key
+	err       error
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+}
+
+// NewKeyFile loads the JWK set at path.
+func NewKeyFile(path string) (*KeyFile, error) {
+	f := &KeyFile{path: path, interval: defaultReloadInterval}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Keys returns the current keys, reloading the file if it changed.
+func (f *KeyFile) Keys() []Key {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(f.lastCheck) >= f.interval {
+		f.lastCheck = now
+		info, err := os.Stat(f.path)
+		if err == nil && (!info.ModTime().Equal(f.modTime) || info.Size() != f.size) {
+			err = f.load()
+		}
+		f.setErr(err)
+	}
+	return f.keys
+}
+
+// Err returns why the last reload failed, or nil if the keys are current.
+func (f *KeyFile) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// setErr records the outcome of a reload, logging only changes so a broken
+// file is not reported on every check.
+func (f *KeyFile) setErr(err error) {
+	switch {
+	case err != nil && (f.err == nil || f.err.Error() != err.Error()):
+		slog.Error("reloading JWK set failed, keeping previous keys", "path", f.path, "error", err)
+	case err == nil && f.err != nil:
+		slog.Info("JWK set reloaded", "path", f.path)
+	}
+	f.err = err
+}
+
+// load must be called with f.mu held, or before f is shared.
+func (f *KeyFile) load() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	f.keys, f.modTime, f.size = keys, info.ModTime(), info.Size()
+	return nil
+}
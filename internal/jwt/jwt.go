@@ -0,0 +1,286 @@
+// Package jwt verifies JSON Web Tokens against locally stored keys.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported algorithm")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("token is expired")
+	ErrNoExpiration     = errors.New("token has no expiration")
+	ErrNotYetValid      = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+)
+
+// Claims is the decoded payload of a token.
+type Claims map[string]any
+
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+func (c Claims) Issuer() string {
+	s, _ := c["iss"].(string)
+	return s
+}
+
+// Audience returns the aud claim, which may be a string or a list.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		out := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Time returns a NumericDate claim such as exp.
+func (c Claims) Time(name string) (time.Time, bool, error) {
+	v, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(float64)
+	if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrMalformed, name)
+	}
+	sec, frac := math.Modf(n)
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+// KeySource supplies the keys tokens are verified with. *KeyFile is one.
+type KeySource interface {
+	Keys() []Key
+}
+
+// StaticKeys is a fixed KeySource.
+type StaticKeys []Key
+
+func (k StaticKeys) Keys() []Key { return k }
+
+// Verifier checks token signatures and registered claims.
+type Verifier struct {
+	keys       KeySource
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	requireExp bool
+	algorithms []string
+	now        func() time.Time
+}
+
+const defaultLeeway = time.Minute
+
+type Option func(*Verifier)
+
+// WithIssuer requires the iss claim to equal issuer.
+func WithIssuer(issuer string) Option {
+	return func(v *Verifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience requires audience to be among the aud claim.
+func WithAudience(audience string) Option {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+// WithLeeway sets the clock skew tolerated on exp and nbf. The default is
+// one minute.
+func WithLeeway(d time.Duration) Option {
+	return func(v *Verifier) {
+		v.leeway = d
+	}
+}
+
+// WithRequireExpiration sets whether tokens without an exp claim are
+// refused. They are by default, since they would stay valid forever.
+func WithRequireExpiration(require bool) Option {
+	return func(v *Verifier) {
+		v.requireExp = require
+	}
+}
+
+// WithAlgorithms restricts the accepted algorithms. By default RS256,
+// ES256, EdDSA and HS256 are all accepted.
+func WithAlgorithms(algs ...string) Option {
+	return func(v *Verifier) {
+		v.algorithms = algs
+	}
+}
+
+func NewVerifier(keys KeySource, opts ...Option) *Verifier {
+	v := &Verifier{
+		keys:       keys,
+		leeway:     defaultLeeway,
+		requireExp: true,
+		algorithms: []string{"RS256", "ES256", "EdDSA", "HS256"},
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Verify checks the token and returns its claims.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(v.algorithms, h.Alg) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, h.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !v.verifySignature(h, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(s string, out any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+func (v *Verifier) verifySignature(h header, signed, signature []byte) bool {
+	for _, key := range v.keys.Keys() {
+		if h.Kid != "" && key.ID != h.Kid {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != h.Alg {
+			continue
+		}
+		if verifyWith(h.Alg, key.Public, signed, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyWith checks the signature with one key. The key type must match the
+// algorithm, so a public key can never be used as an HMAC secret.
+func verifyWith(alg string, public any, signed, signature []byte) bool {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case "RS256":
+		key, ok := public.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+
+	case "ES256":
+		key, ok := public.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key, digest[:], r, s)
+
+	case "EdDSA":
+		key, ok := public.(ed25519.PublicKey)
+		return ok && ed25519.Verify(key, signed, signature)
+
+	case "HS256":
+		secret, ok := public.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	}
+
+	return false
+}
+
+func (v *Verifier) validate(c Claims) error {
+	now := v.now()
+
+	exp, ok, err := c.Time("exp")
+	if err != nil {
+		return err
+	}
+	if !ok && v.requireExp {
+		return ErrNoExpiration
+	}
+	if ok && now.After(exp.Add(v.leeway)) {
+		return ErrExpired
+	}
+
+	nbf, ok, err := c.Time("nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Before(nbf.Add(-v.leeway)) {
+		return ErrNotYetValid
+	}
+
+	if v.issuer != "" && c.Issuer() != v.issuer {
+		return ErrInvalidIssuer
+	}
+	if v.audience != "" && !slices.Contains(c.Audience(), v.audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	ed      ed25519.PrivateKey
+	secret  []byte
+	jwksRaw []byte
+}
+
+var b64 = base64.RawURLEncoding
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	k := &testKeys{secret: []byte("an hmac secret of decent length!")}
+
+	var err error
+	k.rsa, err = rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	k.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, k.ed, err = ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecPoint, err := k.ec.PublicKey.Bytes()
+	require.NoError(t, err)
+	e := big32(k.rsa.E)
+
+	k.jwksRaw, err = json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "n": b64.EncodeToString(k.rsa.N.Bytes()), "e": b64.EncodeToString(e)},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64.EncodeToString(ecPoint[1:33]), "y": b64.EncodeToString(ecPoint[33:])},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64.EncodeToString(k.ed.Public().(ed25519.PublicKey))},
+		{"kty": "oct", "kid": "hs", "alg": "HS256", "k": b64.EncodeToString(k.secret)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+	require.NoError(t, err)
+	return k
+}
+
+func big32(e int) []byte {
+	return []byte{byte(e >> 16), byte(e >> 8), byte(e)}
+}
+
+// sign builds a token for claims with the given algorithm and key ID.
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	h, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case "EdDSA":
+		sig = ed25519.Sign(k.ed, []byte(signed))
+	case "HS256", "none":
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	}
+
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func writeJWKS(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestVerifySignatures(t *testing.T) {
+	k := newTestKeys(t)
+	keys, err := ParseJWKS(k.jwksRaw)
+	require.NoError(t, err)
+	require.Len(t, keys, 4)
+	v := NewVerifier(StaticKeys(keys))
+
+	claims := map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	for _, tc := range []struct{ alg, kid string }{
+		{"RS256", "rsa"},
+		{"ES256", "ec"},
+		{"EdDSA", "ed"},
+		{"HS256", "hs"},
+		// Without a kid every key is tried.
+		{"ES256", ""},
+	} {
+		c, err := v.Verify(k.sign(t, tc.alg, tc.kid, claims))
+		require.NoError(t, err, tc.alg)
+		assert.Equal(t, "alice", c.Subject(), tc.alg)
+	}
+
+	// Test: Wrong kid
+	_, err = v.Verify(k.sign(t, "ES256", "rsa", claims))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Test: Tampered payload
+	token := k.sign(t, "RS256", "rsa", claims)
+	parts := strings.Split(token, ".")
+	parts[1] = b64.EncodeToString([]byte(`{"sub":"mallory"}`))
+	_, err = v.Verify(strings.Join(parts, "."))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Test: alg none and unknown algorithms are refused
+	_, err = v.Verify(k.sign(t, "none", "", claims))
+	assert.ErrorIs(t, err, ErrUnsupportedAlg)
+	_, err = NewVerifier(StaticKeys(keys), WithAlgorithms("RS256")).Verify(k.sign(t, "HS256", "hs", claims))
+	assert.ErrorIs(t, err, ErrUnsupportedAlg)
+
+	// Test: An RSA public key is not usable as an HMAC secret
+	rsaOnly := StaticKeys{{ID: "rsa", Public: &k.rsa.PublicKey}}
+	_, err = NewVerifier(rsaOnly).Verify(k.sign(t, "HS256", "rsa", claims))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Test: Malformed tokens
+	for _, token := range []string{"", "a.b", "a.b.c", "eyJhbGciOiJIUzI1NiJ9.e30.!!!"} {
+		_, err = v.Verify(token)
+		assert.ErrorIs(t, err, ErrMalformed, token)
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	k := newTestKeys(t)
+	keys, err := ParseJWKS(k.jwksRaw)
+	require.NoError(t, err)
+
+	now := time.Unix(1_700_000_000, 0)
+	v := NewVerifier(StaticKeys(keys),
+		WithIssuer("https://issuer.example"),
+		WithAudience("orders"),
+		WithLeeway(30*time.Second),
+	)
+	v.now = func() time.Time { return now }
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"sub": "alice",
+			"iss": "https://issuer.example",
+			"aud": []string{"billing", "orders"},
+			"exp": now.Add(time.Minute).Unix(),
+			"nbf": now.Add(-time.Minute).Unix(),
+		}
+	}
+
+	_, err = v.Verify(k.sign(t, "EdDSA", "ed", valid()))
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name  string
+		claim string
+		value any
+		err   error
+	}{
+		{"expired", "exp", now.Add(-time.Minute).Unix(), ErrExpired},
+		{"expired within leeway", "exp", now.Add(-20 * time.Second).Unix(), nil},
+		{"not yet valid", "nbf", now.Add(time.Minute).Unix(), ErrNotYetValid},
+		{"nbf within leeway", "nbf", now.Add(20 * time.Second).Unix(), nil},
+		{"fractional exp", "exp", float64(now.Unix()) + 0.5, nil},
+		{"wrong issuer", "iss", "https://evil.example", ErrInvalidIssuer},
+		{"wrong audience", "aud", "billing", ErrInvalidAudience},
+		{"single audience", "aud", "orders", nil},
+		{"exp is not a number", "exp", "tomorrow", ErrMalformed},
+		{"missing exp", "exp", nil, ErrNoExpiration},
+	} {
+		claims := valid()
+		claims[tc.claim] = tc.value
+		if tc.value == nil {
+			delete(claims, tc.claim)
+		}
+		_, err := v.Verify(k.sign(t, "EdDSA", "ed", claims))
+		if tc.err == nil {
+			assert.NoError(t, err, tc.name)
+		} else {
+			assert.ErrorIs(t, err, tc.err, tc.name)
+		}
+	}
+
+	// Test: Tokens without exp when it is not required
+	claims := valid()
+	delete(claims, "exp")
+	lax := NewVerifier(StaticKeys(keys), WithRequireExpiration(false))
+	lax.now = v.now
+	_, err = lax.Verify(k.sign(t, "EdDSA", "ed", claims))
+	assert.NoError(t, err)
+}
+
+func TestKeyFileReload(t *testing.T) {
+	k := newTestKeys(t)
+	other := newTestKeys(t)
+	path := writeJWKS(t, k.jwksRaw)
+
+	f, err := NewKeyFile(path)
+	require.NoError(t, err)
+	f.interval = 0
+	v := NewVerifier(f)
+	live := map[string]any{"exp": time.Now().Add(time.Hour).Unix()}
+
+	_, err = v.Verify(k.sign(t, "ES256", "ec", live))
+	require.NoError(t, err)
+	_, err = v.Verify(other.sign(t, "ES256", "ec", live))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// Test: Rotated keys are picked up
+	require.NoError(t, os.WriteFile(path, other.jwksRaw, 0o600))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, future, future))
+	_, err = v.Verify(other.sign(t, "ES256", "ec", live))
+	assert.NoError(t, err)
+	_, err = v.Verify(k.sign(t, "ES256", "ec", live))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	assert.NoError(t, f.Err())
+
+	// Test: A broken file keeps the previous keys and reports why
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0o600))
+	_, err = v.Verify(other.sign(t, "ES256", "ec", live))
+	assert.NoError(t, err)
+	assert.Error(t, f.Err())
+
+	// Test: Fixing the file clears the error
+	require.NoError(t, os.WriteFile(path, k.jwksRaw, 0o600))
+	_, err = v.Verify(k.sign(t, "ES256", "ec", live))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Err())
+
+	// Test: A removed file is reported too
+	require.NoError(t, os.Remove(path))
+	_, err = v.Verify(k.sign(t, "ES256", "ec", live))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, f.Err(), os.ErrNotExist)
+
+	// Test: Missing file
+	_, err = NewKeyFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	k := newTestKeys(t)
+	keys, err := ParseJWKS(k.jwksRaw)
+	require.NoError(t, err)
+
+	handler := New("api", NewVerifier(StaticKeys(keys)))(func(w *response.Writer, req *request.Request) {
+		claims, ok := ClaimsFrom(req)
+		require.True(t, ok)
+		body := claims.Subject() + " " + claims["scope"].(string)
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody([]byte(body))
+	})
+
+	serve := func(token string) *response.Response {
+		raw := "GET / HTTP/1.1\r\nAuthorization: Bearer " + token + "\r\n\r\n"
+		req, err := request.RequestFromReader(strings.NewReader(raw))
+		require.NoError(t, err)
+		out := &bytes.Buffer{}
+		handler(&response.Writer{Writer: out, State: response.StatusLine}, req)
+		out.WriteString("\r\n")
+		r, err := response.ParseFromReader(out)
+		require.NoError(t, err)
+		return r
+	}
+
+	r := serve(k.sign(t, "RS256", "rsa", map[string]any{"sub": "alice", "scope": "read", "exp": time.Now().Add(time.Hour).Unix()}))
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, "alice read", string(r.Body))
+
+	r = serve("not-a-jwt")
+	assert.Equal(t, response.Unauthorized, r.StatusLine.StatusCode)
+	assert.Equal(t, `Bearer realm="api", error="invalid_token"`, r.Headers.Get("WWW-Authenticate"))
+}
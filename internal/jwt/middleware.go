@@ -0,0 +1,30 @@
+package jwt
+
+import (
+	"httpFromTcp/internal/auth"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/server"
+)
+
+// New returns a middleware requiring a valid bearer JWT. The token's
+// subject becomes the principal and its claims are available through
+// ClaimsFrom.
+func New(realm string, v *Verifier) server.Middleware {
+	return auth.Bearer(realm, func(token string) (*auth.Principal, error) {
+		claims, err := v.Verify(token)
+		if err != nil {
+			return nil, err
+		}
+		return &auth.Principal{Name: claims.Subject(), Scheme: "Bearer", Claims: claims}, nil
+	})
+}
+
+// ClaimsFrom returns the claims of the token the request was authenticated
+// with.
+func ClaimsFrom(req *request.Request) (Claims, bool) {
+	p, ok := auth.PrincipalFrom(req)
+	if !ok || p.Claims == nil {
+		return nil, false
+	}
+	return Claims(p.Claims), true
+}
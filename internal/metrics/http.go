@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+// sizeBuckets suit body sizes in bytes, from 100B to 100MB.
+var sizeBuckets = ExponentialBuckets(100, 10, 7)
+
+// RouteFunc names the route a request is counted under. Every route gets
+// its own series, so it must come from a small set, never from the raw
+// request target.
+type RouteFunc func(*request.Request) string
+
+// Routes matches the request path against patterns. A pattern ending in "/"
+// matches every path below it and others match exactly; the longest match
+// wins. Requests matching none are counted as "other".
+func Routes(patterns ...string) RouteFunc {
+	patterns = slices.Clone(patterns)
+	slices.SortFunc(patterns, func(a, b string) int { return len(b) - len(a) })
+
+	return func(req *request.Request) string {
+		path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+		for _, p := range patterns {
+			if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+				return p
+			}
+		}
+		return "other"
+	}
+}
+
+// HTTP instruments a server with the standard request metrics.
+type HTTP struct {
+	requests     *CounterVec
+	duration     *HistogramVec
+	requestSize  *HistogramVec
+	responseSize *HistogramVec
+	inFlight     *Gauge
+	parseErrors  *CounterVec
+
+	route RouteFunc
+	now   func() time.Time
+}
+
+type Option func(*HTTP)
+
+// WithRoute sets how requests are grouped. By default every request is
+// counted under the route "all".
+func WithRoute(fn RouteFunc) Option {
+	return func(m *HTTP) {
+		m.route = fn
+	}
+}
+
+// NewHTTP registers the request metrics in reg.
+func NewHTTP(reg *Registry, opts ...Option) *HTTP {
+	m := &HTTP{
+		requests: reg.NewCounterVec("http_requests_total",
+			"Requests handled, by method, route and status code.", "method", "route", "status"),
+		duration: reg.NewHistogramVec("http_request_duration_seconds",
+			"Time spent handling requests.", DefaultBuckets, "method", "route"),
+		requestSize: reg.NewHistogramVec("http_request_size_bytes",
+			"Size of request bodies.", sizeBuckets, "method", "route"),
+		responseSize: reg.NewHistogramVec("http_response_size_bytes",
+			"Size of response bodies as sent.", sizeBuckets, "method", "route"),
+		inFlight: reg.NewGauge("http_requests_in_flight",
+			"Requests being handled."),
+		parseErrors: reg.NewCounterVec("http_request_parse_errors_total",
+			"Requests rejected while reading or parsing them, by type of error.", "type"),
+		route: func(*request.Request) string { return "all" },
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Middleware records every request passing through it. It should be the
+// outermost middleware so it measures the whole response.
+func (m *HTTP) Middleware() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := m.now()
+			m.inFlight.Inc()
+
+			// Observe from a defer so that a panicking handler counts as
+			// the 500 the server answers it with.
+			handled := false
+			defer func() {
+				m.inFlight.Dec()
+
+				code := w.Status()
+				if !handled && w.State == response.StatusLine {
+					code = response.InternalError
+				}
+				method, route := method(req.RequestLine.Method), m.route(req)
+				status := strconv.Itoa(int(code))
+				m.requests.With(method, route, status).Inc()
+				m.duration.With(method, route).Observe(m.now().Sub(start).Seconds())
+				m.requestSize.With(method, route).Observe(float64(len(req.Body)))
+				m.responseSize.With(method, route).Observe(float64(w.BytesWritten()))
+			}()
+
+			next(w, req)
+			handled = true
+		}
+	}
+}
+
+// ParseError counts err by type. Pass it to server.WithParseErrorHook.
+func (m *HTTP) ParseError(err error) {
+	m.parseErrors.With(errorType(err)).Inc()
+}
+
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, request.ErrUnsupportedTransferCoding):
+		return "unsupported_transfer_coding"
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return "body_too_large"
+	case errors.Is(err, request.ErrHeadTooLarge):
+		return "head_too_large"
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "incomplete"
+	case errors.Is(err, request.ErrMalformedRequestLine):
+		return "request_line"
+	case errors.Is(err, headers.ErrMalformedHeader):
+		return "header"
+	case errors.Is(err, request.ErrInvalidFraming):
+		return "framing"
+	case errors.Is(err, request.ErrMalformedRequest):
+		return "malformed"
+	default:
+		return "read_error"
+	}
+}
+
+// method keeps arbitrary methods sent by clients from making new series.
+func method(m string) string {
+	switch m {
+	case "GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH":
+		return m
+	default:
+		return "other"
+	}
+}
+
+// RegisterConnStats exposes the server's connection counts, read from
+// stats on every scrape. Pass the server's ConnStats method.
+func RegisterConnStats(reg *Registry, stats func() server.ConnStats) {
+	reg.NewGaugeFunc("http_connections_open", "Connections being served.", func() float64 {
+		return float64(stats().Open)
+	})
+	reg.NewCounterFunc("http_connections_accepted_total", "Connections accepted.", func() float64 {
+		return float64(stats().Accepted)
+	})
+	reg.NewCounterVecFunc("http_connections_rejected_total", "Connections turned away by the connection limits, by limit.", "limit", func() map[string]float64 {
+		s := stats()
+		return map[string]float64{
+			"max":    float64(s.RejectedMax),
+			"per_ip": float64(s.RejectedPerIP),
+			"queue":  float64(s.RejectedQueue),
+		}
+	})
+}
@@ -0,0 +1,300 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets suit latencies in seconds, from 5ms to 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ExponentialBuckets returns count buckets, the first with upper bound
+// start and each next one factor times larger.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// family is a metric with one series per combination of label values.
+type family[T any] struct {
+	name   string
+	help   string
+	labels []string
+
+	mu       sync.Mutex
+	series   map[string]T
+	values   map[string][]string
+	newValue func() T
+}
+
+func newFamily[T any](name, help string, labels []string, newValue func() T) *family[T] {
+	return &family[T]{
+		name:     name,
+		help:     help,
+		labels:   slices.Clone(labels),
+		series:   map[string]T{},
+		values:   map[string][]string{},
+		newValue: newValue,
+	}
+}
+
+func (f *family[T]) with(values []string) T {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = f.newValue()
+		f.series[key] = s
+		f.values[key] = slices.Clone(values)
+	}
+	return s
+}
+
+// each calls fn for every series, ordered by label values.
+func (f *family[T]) each(fn func(values []string, s T)) {
+	f.mu.Lock()
+	keys := slices.Sorted(maps.Keys(f.series))
+	series := make([]T, len(keys))
+	values := make([][]string, len(keys))
+	for i, k := range keys {
+		series[i], values[i] = f.series[k], f.values[k]
+	}
+	f.mu.Unlock()
+
+	for i := range keys {
+		fn(values[i], series[i])
+	}
+}
+
+// atomicFloat is a float64 updated without locks.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (a *atomicFloat) add(v float64) {
+	for {
+		old := a.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if a.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (a *atomicFloat) load() float64   { return math.Float64frombits(a.bits.Load()) }
+func (a *atomicFloat) store(v float64) { a.bits.Store(math.Float64bits(v)) }
+
+// Counter is a value that only goes up.
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add adds v, which must not be negative.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.add(v)
+}
+
+func (c *Counter) Value() float64 { return c.v.load() }
+
+type CounterVec struct {
+	f *family[*Counter]
+}
+
+// NewCounterVec registers a counter with the given labels.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{newFamily(name, help, labels, func() *Counter { return &Counter{} })}
+	r.register(name, labels, cv)
+	return cv
+}
+
+// NewCounter registers a counter without labels.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+// With returns the counter for the given label values, in the order the
+// labels were registered.
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.f.with(values)
+}
+
+func (cv *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, cv.f.name, cv.f.help, "counter")
+	cv.f.each(func(values []string, c *Counter) {
+		writeSample(w, cv.f.name, cv.f.labels, values, "", c.Value())
+	})
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64)  { g.v.store(v) }
+func (g *Gauge) Add(v float64)  { g.v.add(v) }
+func (g *Gauge) Inc()           { g.v.add(1) }
+func (g *Gauge) Dec()           { g.v.add(-1) }
+func (g *Gauge) Value() float64 { return g.v.load() }
+
+type GaugeVec struct {
+	f *family[*Gauge]
+}
+
+// NewGaugeVec registers a gauge with the given labels.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	gv := &GaugeVec{newFamily(name, help, labels, func() *Gauge { return &Gauge{} })}
+	r.register(name, labels, gv)
+	return gv
+}
+
+// NewGauge registers a gauge without labels.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+// With returns the gauge for the given label values.
+func (gv *GaugeVec) With(values ...string) *Gauge {
+	return gv.f.with(values)
+}
+
+func (gv *GaugeVec) write(w *bufio.Writer) {
+	writeHeader(w, gv.f.name, gv.f.help, "gauge")
+	gv.f.each(func(values []string, g *Gauge) {
+		writeSample(w, gv.f.name, gv.f.labels, values, "", g.Value())
+	})
+}
+
+// funcMetric reads its values from a function when scraped, for values
+// kept elsewhere such as the server's connection counts.
+type funcMetric struct {
+	name  string
+	help  string
+	typ   string
+	label string
+	fn    func() map[string]float64
+}
+
+// NewGaugeFunc registers a gauge whose value is fn's result.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, nil, &funcMetric{name, help, "gauge", "", single(fn)})
+}
+
+// NewCounterFunc registers a counter whose value is fn's result, which must
+// never decrease.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, nil, &funcMetric{name, help, "counter", "", single(fn)})
+}
+
+// NewCounterVecFunc registers a counter with one label, whose values fn
+// returns keyed by label value.
+func (r *Registry) NewCounterVecFunc(name, help, label string, fn func() map[string]float64) {
+	r.register(name, []string{label}, &funcMetric{name, help, "counter", label, fn})
+}
+
+func single(fn func() float64) func() map[string]float64 {
+	return func() map[string]float64 {
+		return map[string]float64{"": fn()}
+	}
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, m.name, m.help, m.typ)
+	values := m.fn()
+	for _, k := range slices.Sorted(maps.Keys(values)) {
+		if m.label == "" {
+			writeSample(w, m.name, nil, nil, "", values[k])
+		} else {
+			writeSample(w, m.name, []string{m.label}, []string{k}, "", values[k])
+		}
+	}
+}
+
+// Histogram counts observations into buckets.
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	// Buckets are upper bounds, inclusive.
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+type HistogramVec struct {
+	f *family[*Histogram]
+}
+
+// NewHistogramVec registers a histogram with the given bucket upper bounds
+// and labels. A +Inf bucket is always added.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	buckets = slices.Compact(buckets)
+	if n := len(buckets); n > 0 && math.IsInf(buckets[n-1], 1) {
+		buckets = buckets[:n-1]
+	}
+
+	hv := &HistogramVec{newFamily(name, help, labels, func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	})}
+	r.register(name, labels, hv)
+	return hv
+}
+
+// With returns the histogram for the given label values.
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.f.with(values)
+}
+
+func (hv *HistogramVec) write(w *bufio.Writer) {
+	name := hv.f.name
+	writeHeader(w, name, hv.f.help, "histogram")
+	hv.f.each(func(values []string, h *Histogram) {
+		h.mu.Lock()
+		counts := slices.Clone(h.counts)
+		sum, count := h.sum, h.count
+		h.mu.Unlock()
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += counts[i]
+			writeSample(w, name+"_bucket", hv.f.labels, values, `le="`+formatFloat(upper)+`"`, float64(cumulative))
+		}
+		writeSample(w, name+"_bucket", hv.f.labels, values, `le="+Inf"`, float64(count))
+		writeSample(w, name+"_sum", hv.f.labels, values, "", sum)
+		writeSample(w, name+"_count", hv.f.labels, values, "", float64(count))
+	})
+}
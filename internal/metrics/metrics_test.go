@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+func scrape(t *testing.T, reg *Registry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	_, err := reg.WriteTo(&buf)
+	require.NoError(t, err)
+	return buf.String()
+}
+
+func TestExposition(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("jobs_total", "Jobs done.\nBy queue.", "queue")
+	c.With("b").Add(2.5)
+	c.With("a").Inc()
+	c.With(`we"ird\`).Inc()
+	g := reg.NewGauge("temperature", "Current temperature.")
+	g.Set(21)
+	g.Dec()
+	h := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1, 0.5}, "op")
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		h.With("read").Observe(v)
+	}
+
+	assert.Equal(t, `# HELP jobs_total Jobs done.\nBy queue.
+# TYPE jobs_total counter
+jobs_total{queue="a"} 1
+jobs_total{queue="b"} 2.5
+jobs_total{queue="we\"ird\\"} 1
+# HELP temperature Current temperature.
+# TYPE temperature gauge
+temperature 20
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="read",le="0.1"} 2
+latency_seconds_bucket{op="read",le="0.5"} 3
+latency_seconds_bucket{op="read",le="1"} 3
+latency_seconds_bucket{op="read",le="+Inf"} 4
+latency_seconds_sum{op="read"} 2.45
+latency_seconds_count{op="read"} 4
+`, scrape(t, reg))
+
+	// Test: Invalid registrations
+	assert.Panics(t, func() { reg.NewCounter("jobs_total", "Again.") })
+	assert.Panics(t, func() { reg.NewCounter("bad-name", "Bad.") })
+	assert.Panics(t, func() { reg.NewCounterVec("ok_total", "Bad label.", "le") })
+	assert.Panics(t, func() { c.With("a", "b") })
+	assert.Panics(t, func() { c.With("a").Add(-1) })
+}
+
+func TestFuncMetrics(t *testing.T) {
+	reg := NewRegistry()
+	stats := server.ConnStats{Open: 3, Accepted: 10, RejectedMax: 2, RejectedPerIP: 1}
+	RegisterConnStats(reg, func() server.ConnStats { return stats })
+
+	out := scrape(t, reg)
+	assert.Contains(t, out, "# TYPE http_connections_open gauge\nhttp_connections_open 3\n")
+	assert.Contains(t, out, "http_connections_accepted_total 10\n")
+	assert.Contains(t, out, `http_connections_rejected_total{limit="max"} 2`+"\n"+
+		`http_connections_rejected_total{limit="per_ip"} 1`+"\n"+
+		`http_connections_rejected_total{limit="queue"} 0`+"\n")
+
+	// Test: Values are read on every scrape
+	stats.Open = 0
+	assert.Contains(t, scrape(t, reg), "http_connections_open 0\n")
+}
+
+func TestRoutes(t *testing.T) {
+	route := Routes("/assets/", "/assets/img/", "/video")
+	for target, want := range map[string]string{
+		"/":              "other",
+		"/assets/a.css":  "/assets/",
+		"/assets/img/x":  "/assets/img/",
+		"/video?t=10":    "/video",
+		"/videos":        "other",
+		"/unknown/thing": "other",
+	} {
+		req := &request.Request{RequestLine: request.RequestLine{RequestTarget: target}}
+		assert.Equal(t, want, route(req), target)
+	}
+
+	// Test: "/" matches everything left
+	req := &request.Request{RequestLine: request.RequestLine{RequestTarget: "/unknown"}}
+	assert.Equal(t, "/", Routes("/", "/video")(req))
+}
+
+func TestMiddleware(t *testing.T) {
+	reg := NewRegistry()
+	now := time.Unix(0, 0)
+	m := NewHTTP(reg, WithRoute(Routes("/", "/items/")), withClock(func() time.Time {
+		now = now.Add(30 * time.Millisecond)
+		return now
+	}))
+
+	var inFlight float64
+	handler := server.Chain(func(w *response.Writer, req *request.Request) {
+		inFlight = m.inFlight.Value()
+		body := "hello"
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody([]byte(body))
+	}, m.Middleware())
+
+	for _, raw := range []string{
+		"POST /items/1 HTTP/1.1\r\nContent-Length: 250\r\n\r\n" + strings.Repeat("a", 250),
+		"GET /items/2?x=1 HTTP/1.1\r\n\r\n",
+		"BREW /items/3 HTTP/1.1\r\n\r\n",
+	} {
+		req, err := request.RequestFromReader(strings.NewReader(raw))
+		require.NoError(t, err)
+		handler(&response.Writer{Writer: io.Discard, State: response.StatusLine}, req)
+	}
+
+	out := scrape(t, reg)
+	assert.Equal(t, 1.0, inFlight)
+	assert.Equal(t, 0.0, m.inFlight.Value())
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/items/",status="200"} 1`)
+	assert.Contains(t, out, `http_requests_total{method="POST",route="/items/",status="200"} 1`)
+	assert.Contains(t, out, `http_requests_total{method="other",route="/items/",status="200"} 1`)
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/items/",le="0.025"} 0`)
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/items/",le="0.05"} 1`)
+	assert.Contains(t, out, `http_request_size_bytes_bucket{method="POST",route="/items/",le="100"} 0`)
+	assert.Contains(t, out, `http_request_size_bytes_bucket{method="POST",route="/items/",le="1000"} 1`)
+	assert.Contains(t, out, `http_response_size_bytes_sum{method="GET",route="/items/"} 5`)
+}
+
+func TestMiddlewarePanic(t *testing.T) {
+	reg := NewRegistry()
+	m := NewHTTP(reg)
+	handler := server.Chain(func(w *response.Writer, req *request.Request) { panic("boom") }, m.Middleware())
+
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.PanicsWithValue(t, "boom", func() {
+		handler(&response.Writer{Writer: io.Discard, State: response.StatusLine}, req)
+	})
+
+	// Test: The request counts as the 500 the server sends for it
+	out := scrape(t, reg)
+	assert.Contains(t, out, `http_requests_total{method="GET",route="all",status="500"} 1`)
+	assert.Contains(t, out, `http_request_duration_seconds_count{method="GET",route="all"} 1`)
+	assert.Equal(t, 0.0, m.inFlight.Value())
+}
+
+func TestParseErrors(t *testing.T) {
+	reg := NewRegistry()
+	m := NewHTTP(reg)
+
+	for _, raw := range []string{
+		"GET / HTTP/2.0\r\n\r\n",
+		"GET / HTTP/1.1\r\nno colon\r\n\r\n",
+		"GET / HTTP/1.1\r\n folded: x\r\n\r\n",
+		"POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n",
+		"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+		"GET / HTTP/1.1\r\nHost: x",
+		"GET /" + strings.Repeat("a", 64<<10),
+	} {
+		_, err := request.RequestFromReader(strings.NewReader(raw))
+		require.Error(t, err)
+		m.ParseError(err)
+	}
+	m.ParseError(fmt.Errorf("%w: too big", request.ErrBodyTooLarge))
+	m.ParseError(io.ErrClosedPipe)
+
+	out := scrape(t, reg)
+	for typ, n := range map[string]int{
+		"request_line": 1, "header": 2, "framing": 1, "unsupported_transfer_coding": 1,
+		"malformed": 1, "incomplete": 1, "body_too_large": 1, "read_error": 1,
+		"head_too_large": 1,
+	} {
+		assert.Contains(t, out, fmt.Sprintf("http_request_parse_errors_total{type=%q} %d\n", typ, n))
+	}
+}
+
+func TestHandle(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("up_total", "Up.").Inc()
+
+	req, err := request.RequestFromReader(strings.NewReader("GET /metrics HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	reg.Handle(&response.Writer{Writer: out, State: response.StatusLine}, req)
+	out.WriteString("\r\n")
+
+	res, err := response.ParseFromReader(out)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, res.StatusLine.StatusCode)
+	assert.Equal(t, ContentType, res.Headers.Get("Content-Type"))
+	assert.Equal(t, "# HELP up_total Up.\n# TYPE up_total counter\nup_total 1\n", string(res.Body))
+}
+
+func withClock(now func() time.Time) Option {
+	return func(m *HTTP) {
+		m.now = now
+	}
+}
@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"httpFromTcp/internal/client"
+	"httpFromTcp/internal/request"
+)
+
+// Strategy decides which backend of a Pool serves a request.
+type Strategy int
+
+const (
+	RoundRobin Strategy = iota
+	LeastConnections
+	ConsistentHash
+)
+
+const (
+	defaultMaxFailures   = 3
+	defaultEjectDuration = 30 * time.Second
+	virtualNodes         = 100
+)
+
+var ErrNoBackend = errors.New("no healthy backend available")
+
+// Backend is a single upstream server in a Pool.
+type Backend struct {
+	URL *url.URL
+
+	healthy      atomic.Bool
+	active       atomic.Int64
+	failures     atomic.Int32
+	ejectedUntil atomic.Int64
+}
+
+// Healthy reports whether the backend is currently eligible for traffic.
+func (b *Backend) Healthy() bool {
+	return b.healthy.Load() && time.Now().UnixNano() >= b.ejectedUntil.Load()
+}
+
+// ActiveRequests is the number of requests currently being proxied to b.
+func (b *Backend) ActiveRequests() int64 {
+	return b.active.Load()
+}
+
+type ringEntry struct {
+	hash    uint32
+	backend *Backend
+}
+
+// Pool spreads requests over a set of backends and tracks their health.
+type Pool struct {
+	backends []*Backend
+	strategy Strategy
+	next     atomic.Uint64
+	ring     []ringEntry
+	hashKey  func(*request.Request) string
+
+	maxFailures   int32
+	ejectDuration time.Duration
+
+	healthPath     string
+	healthInterval time.Duration
+	healthClient   *client.Client
+	stop           chan struct{}
+	stopOnce       sync.Once
+}
+
+type PoolOption func(*Pool)
+
+// WithStrategy sets the balancing strategy, RoundRobin by default.
+func WithStrategy(s Strategy) PoolOption {
+	return func(p *Pool) {
+		p.strategy = s
+	}
+}
+
+// WithHashKey sets the key used by ConsistentHash. The client IP is used by
+// default.
+func WithHashKey(fn func(*request.Request) string) PoolOption {
+	return func(p *Pool) {
+		p.hashKey = fn
+	}
+}
+
+// WithPassiveEjection takes a backend out of rotation for d after
+// maxFailures consecutive failed requests.
+func WithPassiveEjection(maxFailures int, d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.maxFailures = int32(maxFailures)
+		p.ejectDuration = d
+	}
+}
+
+// WithHealthCheck polls path on every backend each interval and only routes
+// to backends answering with a 2xx or 3xx status.
+func WithHealthCheck(path string, interval time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.healthPath = path
+		p.healthInterval = interval
+	}
+}
+
+func NewPool(upstreams []string, opts ...PoolOption) (*Pool, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("pool needs at least one upstream")
+	}
+
+	p := &Pool{
+		hashKey:       (*request.Request).RemoteIP,
+		maxFailures:   defaultMaxFailures,
+		ejectDuration: defaultEjectDuration,
+		stop:          make(chan struct{}),
+	}
+	for _, upstream := range upstreams {
+		u, err := parseUpstream(upstream)
+		if err != nil {
+			return nil, err
+		}
+		b := &Backend{URL: u}
+		b.healthy.Store(true)
+		p.backends = append(p.backends, b)
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.strategy == ConsistentHash {
+		p.buildRing()
+	}
+	if p.healthPath != "" && p.healthInterval > 0 {
+		p.healthClient = client.New(client.WithTimeout(p.healthInterval))
+		go p.healthLoop()
+	}
+
+	return p, nil
+}
+
+// Backends returns the backends of the pool.
+func (p *Pool) Backends() []*Backend {
+	return p.backends
+}
+
+// Close stops the active health checks.
+func (p *Pool) Close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// pick chooses a healthy backend for req that is not in tried.
+func (p *Pool) pick(req *request.Request, tried map[*Backend]bool) (*Backend, error) {
+	switch p.strategy {
+	case LeastConnections:
+		return p.pickLeastConnections(tried)
+	case ConsistentHash:
+		return p.pickConsistentHash(req, tried)
+	default:
+		return p.pickRoundRobin(tried)
+	}
+}
+
+func (p *Pool) pickRoundRobin(tried map[*Backend]bool) (*Backend, error) {
+	n := uint64(len(p.backends))
+	start := p.next.Add(1) - 1
+	for i := uint64(0); i < n; i++ {
+		b := p.backends[(start+i)%n]
+		if b.Healthy() && !tried[b] {
+			return b, nil
+		}
+	}
+	return nil, ErrNoBackend
+}
+
+func (p *Pool) pickLeastConnections(tried map[*Backend]bool) (*Backend, error) {
+	n := uint64(len(p.backends))
+	start := p.next.Add(1) - 1
+	var best *Backend
+	for i := uint64(0); i < n; i++ {
+		b := p.backends[(start+i)%n]
+		if !b.Healthy() || tried[b] {
+			continue
+		}
+		if best == nil || b.ActiveRequests() < best.ActiveRequests() {
+			best = b
+		}
+	}
+	if best == nil {
+		return nil, ErrNoBackend
+	}
+	return best, nil
+}
+
+func (p *Pool) pickConsistentHash(req *request.Request, tried map[*Backend]bool) (*Backend, error) {
+	h := hash32(p.hashKey(req))
+	i := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i].hash >= h
+	})
+	for j := 0; j < len(p.ring); j++ {
+		b := p.ring[(i+j)%len(p.ring)].backend
+		if b.Healthy() && !tried[b] {
+			return b, nil
+		}
+	}
+	return nil, ErrNoBackend
+}
+
+func (p *Pool) buildRing() {
+	p.ring = make([]ringEntry, 0, len(p.backends)*virtualNodes)
+	for _, b := range p.backends {
+		for i := 0; i < virtualNodes; i++ {
+			p.ring = append(p.ring, ringEntry{hash32(b.URL.String() + "#" + strconv.Itoa(i)), b})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool {
+		return p.ring[i].hash < p.ring[j].hash
+	})
+}
+
+func (p *Pool) success(b *Backend) {
+	b.failures.Store(0)
+}
+
+func (p *Pool) failure(b *Backend) {
+	if p.maxFailures <= 0 {
+		return
+	}
+	if b.failures.Add(1) >= p.maxFailures {
+		b.failures.Store(0)
+		b.ejectedUntil.Store(time.Now().Add(p.ejectDuration).UnixNano())
+	}
+}
+
+func (p *Pool) healthLoop() {
+	ticker := time.NewTicker(p.healthInterval)
+	defer ticker.Stop()
+	for {
+		p.checkHealth()
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) checkHealth() {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func(b *Backend) {
+			defer wg.Done()
+			healthy := p.probe(b)
+			b.healthy.Store(healthy)
+			if healthy && !b.Healthy() {
+				// A passing active check ends a passive ejection early.
+				b.ejectedUntil.Store(0)
+				b.failures.Store(0)
+			}
+		}(b)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) probe(b *Backend) bool {
+	u := *b.URL
+	u.Path = joinPath(b.URL.Path, p.healthPath)
+	res, err := p.healthClient.Get(u.String())
+	if err != nil {
+		return false
+	}
+	code := res.StatusLine.StatusCode
+	return code >= 200 && code < 400
+}
+
+func parseUpstream(upstream string) (*url.URL, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported upstream scheme: %s", u.Scheme)
+	}
+	return u, nil
+}
+
+func hash32(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
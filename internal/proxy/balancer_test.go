@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+)
+
+func TestPoolRoundRobin(t *testing.T) {
+	pool, err := NewPool([]string{"http://a", "http://b", "http://c"})
+	require.NoError(t, err)
+
+	req := &request.Request{RemoteAddr: "192.0.2.1:1000"}
+	got := []string{}
+	for i := 0; i < 6; i++ {
+		b, err := pool.pick(req, nil)
+		require.NoError(t, err)
+		got = append(got, b.URL.Host)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, got)
+}
+
+func TestPoolLeastConnections(t *testing.T) {
+	pool, err := NewPool([]string{"http://a", "http://b", "http://c"}, WithStrategy(LeastConnections))
+	require.NoError(t, err)
+
+	backends := pool.Backends()
+	backends[0].active.Store(3)
+	backends[1].active.Store(1)
+	backends[2].active.Store(2)
+
+	for i := 0; i < 3; i++ {
+		b, err := pool.pick(&request.Request{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "b", b.URL.Host)
+	}
+}
+
+func TestPoolConsistentHash(t *testing.T) {
+	pool, err := NewPool([]string{"http://a", "http://b", "http://c"}, WithStrategy(ConsistentHash))
+	require.NoError(t, err)
+
+	// Test: Same client always lands on the same backend
+	seen := map[string]string{}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"} {
+		req := &request.Request{RemoteAddr: ip + ":1234"}
+		first, err := pool.pick(req, nil)
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			b, err := pool.pick(req, nil)
+			require.NoError(t, err)
+			assert.Equal(t, first, b)
+		}
+		seen[ip] = first.URL.Host
+	}
+
+	// Test: Unhealthy backend only moves its own keys
+	victim := pool.Backends()[0]
+	victim.healthy.Store(false)
+	for ip, host := range seen {
+		b, err := pool.pick(&request.Request{RemoteAddr: ip + ":1234"}, nil)
+		require.NoError(t, err)
+		if host != victim.URL.Host {
+			assert.Equal(t, host, b.URL.Host)
+		} else {
+			assert.NotEqual(t, victim, b)
+		}
+	}
+}
+
+func TestPoolPassiveEjection(t *testing.T) {
+	pool, err := NewPool([]string{"http://a", "http://b"}, WithPassiveEjection(2, time.Hour))
+	require.NoError(t, err)
+
+	a := pool.Backends()[0]
+	pool.failure(a)
+	assert.True(t, a.Healthy())
+	pool.failure(a)
+	assert.False(t, a.Healthy())
+
+	for i := 0; i < 4; i++ {
+		b, err := pool.pick(&request.Request{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "b", b.URL.Host)
+	}
+
+	pool.Backends()[1].healthy.Store(false)
+	_, err = pool.pick(&request.Request{}, nil)
+	assert.ErrorIs(t, err, ErrNoBackend)
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	var up atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+
+	pool, err := NewPool([]string{backend.URL}, WithHealthCheck("/healthz", 10*time.Millisecond))
+	require.NoError(t, err)
+	defer pool.Close()
+
+	b := pool.Backends()[0]
+	assert.Eventually(t, func() bool { return !b.Healthy() }, time.Second, 5*time.Millisecond)
+	up.Store(true)
+	assert.Eventually(t, b.Healthy, time.Second, 5*time.Millisecond)
+}
+
+func TestProxyRetriesIdempotentRequests(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	var hits atomic.Int32
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer live.Close()
+
+	pool, err := NewPool([]string{dead.URL, live.URL}, WithPassiveEjection(0, 0))
+	require.NoError(t, err)
+	p := NewBalanced(pool, WithRetries(1))
+
+	// Test: GET falls over to the live backend
+	for i := 0; i < 4; i++ {
+		out := &bytes.Buffer{}
+		p.Handle(newWriter(out), newRequest(t, "GET / HTTP/1.1\r\n\r\n"))
+		assert.True(t, strings.HasPrefix(out.String(), "HTTP/1.1 200 OK\r\n"))
+	}
+	assert.Equal(t, int32(4), hits.Load())
+
+	// Test: POST is never retried
+	codes := map[string]int{}
+	for i := 0; i < 2; i++ {
+		out := &bytes.Buffer{}
+		p.Handle(newWriter(out), newRequest(t, "POST / HTTP/1.1\r\n\r\n"))
+		codes[out.String()[:12]]++
+	}
+	assert.Equal(t, map[string]int{"HTTP/1.1 200": 1, "HTTP/1.1 502": 1}, codes)
+}
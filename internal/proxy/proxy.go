@@ -0,0 +1,367 @@
+// Package proxy forwards requests to an upstream server
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"httpFromTcp/internal/client"
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/trace"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	bufferSize     = 32 * 1024
+)
+
+// hopHeaders only apply to a single connection and are never forwarded.
+var hopHeaders = []string{
+	"connection",
+	"keep-alive",
+	"proxy-authenticate",
+	"proxy-authorization",
+	"proxy-connection",
+	"te",
+	"trailer",
+	"transfer-encoding",
+	"upgrade",
+}
+
+type Proxy struct {
+	pool        *Pool
+	client      *client.Client
+	timeout     time.Duration
+	stripPrefix string
+	integrity   bool
+	retries     int
+}
+
+type Option func(*Proxy)
+
+// WithTimeout limits how long a single upstream exchange may take.
+func WithTimeout(d time.Duration) Option {
+	return func(p *Proxy) {
+		p.timeout = d
+	}
+}
+
+// WithClient replaces the client used to reach the upstream. It takes
+// precedence over WithTimeout.
+func WithClient(c *client.Client) Option {
+	return func(p *Proxy) {
+		p.client = c
+	}
+}
+
+// WithStripPrefix removes prefix from the request path before forwarding.
+func WithStripPrefix(prefix string) Option {
+	return func(p *Proxy) {
+		p.stripPrefix = prefix
+	}
+}
+
+// WithRetries retries idempotent requests up to n times on another backend
+// when the upstream cannot be reached.
+func WithRetries(n int) Option {
+	return func(p *Proxy) {
+		p.retries = n
+	}
+}
+
+// WithIntegrityTrailers sends X-Content-SHA256 and X-Content-Length trailers
+// computed over the streamed response body.
+func WithIntegrityTrailers() Option {
+	return func(p *Proxy) {
+		p.integrity = true
+	}
+}
+
+// New returns a proxy forwarding every request to a single upstream.
+func New(upstream string, opts ...Option) (*Proxy, error) {
+	pool, err := NewPool([]string{upstream}, WithPassiveEjection(0, 0))
+	if err != nil {
+		return nil, err
+	}
+	return NewBalanced(pool, opts...), nil
+}
+
+// NewBalanced returns a proxy spreading requests over the backends of pool.
+func NewBalanced(pool *Pool, opts ...Option) *Proxy {
+	p := &Proxy{
+		pool:    pool,
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.client == nil {
+		p.client = client.New(client.WithTimeout(p.timeout))
+	}
+
+	return p
+}
+
+// Handle forwards req to the upstream and streams the response back. It has
+// the signature of server.Handler.
+func (p *Proxy) Handle(w *response.Writer, req *request.Request) {
+	if _, err := req.ReadBody(); err != nil {
+		writeError(w, response.BadRequest)
+		return
+	}
+
+	attempts := 1
+	if idempotent(req.RequestLine.Method) {
+		attempts += p.retries
+	}
+
+	tried := map[*Backend]bool{}
+	var res *response.Response
+	var body io.ReadCloser
+	var backend *Backend
+	status := response.Unavailable
+	for i := 0; i < attempts && res == nil; i++ {
+		b, err := p.pool.pick(req, tried)
+		if err != nil {
+			break
+		}
+		tried[b] = true
+
+		outReq, err := p.upstreamRequest(req, b.URL)
+		if err != nil {
+			writeError(w, response.BadRequest)
+			return
+		}
+
+		// Each attempt is a client span, and the upstream continues the
+		// trace from it.
+		_, span := trace.Start(req.Context(), req.RequestLine.Method, trace.Client)
+		span.SetAttribute("http.request.method", req.RequestLine.Method)
+		span.SetAttribute("server.address", b.URL.Host)
+		span.SetAttribute("url.full", outReq.URL.String())
+		trace.Inject(span.SpanContext(), outReq.Headers)
+
+		b.active.Add(1)
+		res, body, err = p.client.Stream(outReq)
+		if err != nil {
+			b.active.Add(-1)
+			p.pool.failure(b)
+			status = errorStatus(err)
+			span.SetStatus(trace.Error, err.Error())
+			span.End()
+			continue
+		}
+		span.SetAttribute("http.response.status_code", int(res.StatusLine.StatusCode))
+		if res.StatusLine.StatusCode >= 400 {
+			span.SetStatus(trace.Error, response.StatusText(res.StatusLine.StatusCode))
+		}
+		span.End()
+		if code := res.StatusLine.StatusCode; code >= 502 && code <= 504 {
+			p.pool.failure(b)
+		} else {
+			p.pool.success(b)
+		}
+		backend = b
+	}
+	if res == nil {
+		writeError(w, status)
+		return
+	}
+	defer backend.active.Add(-1)
+	defer body.Close()
+
+	hdrs := headers.NewHeaders()
+	for k, v := range res.Headers {
+		hdrs[k] = v
+	}
+	removeHopHeaders(hdrs)
+
+	// Responses that cannot carry a body are forwarded as they are, with the
+	// upstream's Content-Length describing the representation, if any.
+	code := res.StatusLine.StatusCode
+	bodyless := req.RequestLine.Method == "HEAD" || code/100 == 1 || code == response.NoContent || code == response.NotModified
+	if !bodyless {
+		delete(hdrs, "content-length")
+		hdrs["transfer-encoding"] = "chunked"
+		if p.integrity {
+			hdrs["trailer"] = "X-Content-SHA256, X-Content-Length"
+		}
+	}
+
+	w.WriteStatusLine(code)
+	for _, c := range res.SetCookies {
+		w.AddSetCookie(c)
+	}
+	w.WriteHeaders(hdrs)
+	w.Writer.Write([]byte("\r\n"))
+	if bodyless {
+		return
+	}
+
+	sum := sha256.New()
+	length := 0
+	buf := make([]byte, bufferSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.WriteChunkedBody(buf[:n]); werr != nil {
+				return
+			}
+			sum.Write(buf[:n])
+			length += n
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The status line is already out, so a broken upstream can only
+			// be signalled by leaving the chunked body unterminated. The
+			// server closes the connection after the handler returns.
+			return
+		}
+	}
+	w.WriteChunkedBodyDone()
+
+	if p.integrity {
+		tr := headers.NewHeaders()
+		tr["X-Content-SHA256"] = fmt.Sprintf("%x", sum.Sum(nil))
+		tr["X-Content-Length"] = fmt.Sprint(length)
+		w.WriteTrailers(tr)
+	}
+}
+
+func (p *Proxy) upstreamRequest(req *request.Request, upstream *url.URL) (*client.Request, error) {
+	target, err := url.ParseRequestURI(req.RequestLine.RequestTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	// Join the escaped paths too, so that an encoded "/" or "?" from the
+	// client reaches the upstream still encoded.
+	prefix := &url.URL{Path: p.stripPrefix}
+	u := *upstream
+	u.Path = joinPath(upstream.Path, strings.TrimPrefix(target.Path, p.stripPrefix))
+	u.RawPath = joinPath(upstream.EscapedPath(), strings.TrimPrefix(target.EscapedPath(), prefix.EscapedPath()))
+	u.RawQuery = joinQuery(upstream.RawQuery, target.RawQuery)
+
+	outReq, err := client.NewRequest(req.RequestLine.Method, u.String(), req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range req.Headers {
+		outReq.Headers[k] = v
+	}
+	removeHopHeaders(outReq.Headers)
+	delete(outReq.Headers, "host")
+	delete(outReq.Headers, "content-length")
+	addForwardedHeaders(outReq.Headers, req)
+
+	return outReq, nil
+}
+
+func addForwardedHeaders(h headers.Headers, req *request.Request) {
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	host := req.Headers.Get("Host")
+	ip := req.RemoteIP()
+
+	if ip != "" {
+		if prior := req.Headers.Get("X-Forwarded-For"); prior != "" {
+			h["x-forwarded-for"] = prior + ", " + ip
+		} else {
+			h["x-forwarded-for"] = ip
+		}
+	}
+	if host != "" {
+		h["x-forwarded-host"] = host
+	}
+	h["x-forwarded-proto"] = proto
+
+	forwarded := []string{}
+	if ip != "" {
+		forwarded = append(forwarded, "for="+forwardedNode(ip))
+	}
+	if host != "" {
+		forwarded = append(forwarded, "host="+quoteIfNeeded(host))
+	}
+	forwarded = append(forwarded, "proto="+proto)
+	element := strings.Join(forwarded, ";")
+	if prior := req.Headers.Get("Forwarded"); prior != "" {
+		element = prior + ", " + element
+	}
+	h["forwarded"] = element
+}
+
+// forwardedNode formats an address for the Forwarded header, which requires
+// IPv6 addresses to be bracketed and quoted (RFC 7239 section 6).
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+func quoteIfNeeded(s string) string {
+	if strings.ContainsAny(s, ":;,\" ") {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	return s
+}
+
+func removeHopHeaders(h headers.Headers) {
+	for _, token := range strings.Split(h.Get("Connection"), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			delete(h, strings.ToLower(token))
+		}
+	}
+	for _, k := range hopHeaders {
+		delete(h, k)
+	}
+}
+
+func joinPath(base, path string) string {
+	if base == "" {
+		base = "/"
+	}
+	if path == "" {
+		return base
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+func joinQuery(base, query string) string {
+	if base == "" || query == "" {
+		return base + query
+	}
+	return base + "&" + query
+}
+
+func errorStatus(err error) response.StatusCode {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return response.GatewayTimeout
+	}
+	return response.BadGateway
+}
+
+func writeError(w *response.Writer, status response.StatusCode) {
+	body := fmt.Sprintf("%d %s\n", status, response.StatusText(status))
+	w.WriteStatusLine(status)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody([]byte(body))
+}
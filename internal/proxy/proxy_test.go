@@ -0,0 +1,261 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/trace"
+)
+
+func TestProxyForwardsRequest(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Upstream", "yes")
+		w.WriteHeader(201)
+		w.Write([]byte("created"))
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL+"/base", WithStripPrefix("/api"))
+	require.NoError(t, err)
+
+	req := newRequest(t, "POST /api/items?x=1 HTTP/1.1\r\n"+
+		"Host: example.com\r\n"+
+		"Connection: close, X-Secret\r\n"+
+		"X-Secret: hop\r\n"+
+		"X-Forwarded-For: 10.0.0.1\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\n"+
+		"hello")
+	req.RemoteAddr = "192.0.2.7:5555"
+
+	out := &bytes.Buffer{}
+	p.Handle(newWriter(out), req)
+
+	// Test: Method, path, query and body reach the upstream
+	require.NotNil(t, got)
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "/base/items", got.URL.Path)
+	assert.Equal(t, "x=1", got.URL.RawQuery)
+	assert.Equal(t, "hello", string(gotBody))
+
+	// Test: Hop-by-hop headers are stripped and forwarding headers added
+	assert.Empty(t, got.Header.Get("X-Secret"))
+	assert.Equal(t, "10.0.0.1, 192.0.2.7", got.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "example.com", got.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", got.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "for=192.0.2.7;host=example.com;proto=http", got.Header.Get("Forwarded"))
+
+	// Test: Response is streamed back chunked without hop-by-hop headers
+	resp := out.String()
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.1 201 "))
+	assert.Contains(t, resp, "x-upstream: yes\r\n")
+	assert.Contains(t, resp, "transfer-encoding: chunked\r\n")
+	assert.NotContains(t, resp, "keep-alive")
+	assert.Contains(t, resp, "\r\n\r\n7\r\ncreated\r\n0\r\n")
+}
+
+func TestProxyKeepsEscapedPath(t *testing.T) {
+	var got *http.Request
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.WriteHeader(204)
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL+"/base", WithStripPrefix("/api"))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		target  string
+		rawPath string
+		path    string
+	}{
+		{"/api/files/a%2Fb", "/base/files/a%2Fb", "/base/files/a/b"},
+		{"/api/q%3Fx/y", "/base/q%3Fx/y", "/base/q?x/y"},
+		{"/api/plain", "/base/plain", "/base/plain"},
+	} {
+		got = nil
+		p.Handle(newWriter(&bytes.Buffer{}), newRequest(t, "GET "+tc.target+" HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+		// Test: Percent-encoded bytes reach the upstream still encoded
+		require.NotNil(t, got, tc.target)
+		assert.Equal(t, tc.rawPath, got.URL.EscapedPath(), tc.target)
+		assert.Equal(t, tc.path, got.URL.Path, tc.target)
+	}
+}
+
+func TestProxyIntegrityTrailers(t *testing.T) {
+	body := strings.Repeat("abcdefgh", 10000)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL, WithIntegrityTrailers())
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	p.Handle(newWriter(out), newRequest(t, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+
+	sum := sha256.Sum256([]byte(body))
+	resp := out.String()
+	assert.Contains(t, resp, "trailer: X-Content-SHA256, X-Content-Length\r\n")
+	assert.Contains(t, resp, fmt.Sprintf("0\r\nX-Content-SHA256: %x\r\n", sum))
+	assert.Contains(t, resp, fmt.Sprintf("X-Content-Length: %d\r\n", len(body)))
+}
+
+func TestProxyResponseFraming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/cached":
+			w.WriteHeader(http.StatusNotModified)
+		case "/cookies":
+			w.Header().Add("Set-Cookie", "a=1; Expires=Thu, 01 Jan 1970 00:00:00 GMT")
+			w.Header().Add("Set-Cookie", "b=2")
+			w.Write([]byte("ok"))
+		case "/truncated":
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("short"))
+		default:
+			w.Header().Set("Content-Length", "7")
+			w.Write([]byte("content"))
+		}
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL, WithIntegrityTrailers())
+	require.NoError(t, err)
+	proxy := func(raw string) string {
+		out := &bytes.Buffer{}
+		p.Handle(newWriter(out), newRequest(t, raw))
+		return out.String()
+	}
+
+	// Test: Responses without a body get no body framing
+	for _, raw := range []string{
+		"GET /empty HTTP/1.1\r\n\r\n",
+		"GET /cached HTTP/1.1\r\n\r\n",
+		"HEAD / HTTP/1.1\r\n\r\n",
+	} {
+		resp := proxy(raw)
+		assert.NotContains(t, resp, "transfer-encoding", raw)
+		assert.NotContains(t, resp, "trailer", raw)
+		assert.True(t, strings.HasSuffix(resp, "\r\n\r\n"), raw)
+		assert.Equal(t, 1, strings.Count(resp, "\r\n\r\n"), raw)
+	}
+	assert.Contains(t, proxy("HEAD / HTTP/1.1\r\n\r\n"), "content-length: 7\r\n")
+
+	// Test: Set-Cookie fields stay on their own lines
+	resp := proxy("GET /cookies HTTP/1.1\r\n\r\n")
+	assert.Contains(t, resp, "Set-Cookie: a=1; Expires=Thu, 01 Jan 1970 00:00:00 GMT\r\n")
+	assert.Contains(t, resp, "Set-Cookie: b=2\r\n")
+
+	// Test: A truncated upstream body leaves the stream unterminated
+	resp = proxy("GET /truncated HTTP/1.1\r\n\r\n")
+	assert.Contains(t, resp, "5\r\nshort\r\n")
+	assert.NotContains(t, resp, "0\r\n")
+	assert.NotContains(t, resp, "X-Content-SHA256:")
+}
+
+func TestProxyPropagatesTrace(t *testing.T) {
+	var traceparent, tracestate string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		tracestate = r.Header.Get("tracestate")
+		w.WriteHeader(503)
+	}))
+	defer upstream.Close()
+
+	p, err := New(upstream.URL)
+	require.NoError(t, err)
+
+	exp := trace.NewInMemoryExporter()
+	req := newRequest(t, "GET /items HTTP/1.1\r\ntraceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n\r\n")
+	remote, ok := trace.Extract(req)
+	require.True(t, ok)
+	remote.TraceState = "rojo=1"
+	ctx, srv := trace.NewTracer(exp).Start(trace.ContextWithRemote(req.Context(), remote), "GET", trace.Server)
+	req.SetContext(ctx)
+
+	p.Handle(newWriter(&bytes.Buffer{}), req)
+	srv.End()
+
+	// Test: The upstream continues the trace from the client span
+	spans := exp.Spans()
+	require.Len(t, spans, 2)
+	client := spans[0]
+	assert.Equal(t, trace.Client, client.Kind)
+	assert.Equal(t, srv.SpanContext().SpanID, client.Parent)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+client.SpanContext.SpanID.String()+"-01", traceparent)
+	assert.Equal(t, "rojo=1", tracestate)
+	assert.Equal(t, trace.Error, client.Status)
+
+	// Test: Untraced requests carry no traceparent
+	traceparent = ""
+	p.Handle(newWriter(&bytes.Buffer{}), newRequest(t, "GET / HTTP/1.1\r\n\r\n"))
+	assert.Empty(t, traceparent)
+}
+
+func TestProxyUpstreamErrors(t *testing.T) {
+	// Test: Unreachable upstream
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	url := upstream.URL
+	upstream.Close()
+
+	p, err := New(url)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	p.Handle(newWriter(out), newRequest(t, "GET / HTTP/1.1\r\n\r\n"))
+	assert.True(t, strings.HasPrefix(out.String(), "HTTP/1.1 502 Bad Gateway\r\n"))
+
+	// Test: Slow upstream
+	release := make(chan struct{})
+	upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	p, err = New(upstream.URL, WithTimeout(50*time.Millisecond))
+	require.NoError(t, err)
+	out = &bytes.Buffer{}
+	p.Handle(newWriter(out), newRequest(t, "GET / HTTP/1.1\r\n\r\n"))
+	assert.True(t, strings.HasPrefix(out.String(), "HTTP/1.1 504 Gateway Timeout\r\n"))
+
+	// Test: Invalid upstream
+	_, err = New("ftp://example.com")
+	require.Error(t, err)
+}
+
+func newRequest(t *testing.T, raw string) *request.Request {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	return req
+}
+
+func newWriter(w io.Writer) *response.Writer {
+	return &response.Writer{
+		Writer: w,
+		State:  response.StatusLine,
+	}
+}
@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of counting one request against a key's limit.
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests allowed in a burst or window.
+	Limit int
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+	// Reset is how long until the key's quota is fully restored.
+	Reset time.Duration
+	// RetryAfter is how long a refused client should wait.
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether a request for key may proceed.
+type Limiter interface {
+	Allow(key string) Result
+}
+
+type entry[T any] struct {
+	state    T
+	lastSeen time.Time
+}
+
+// store holds per-key state. Keys idle for longer than idle are dropped,
+// which loses nothing as long as idle is at least the time it takes a key
+// to return to its initial state.
+type store[T any] struct {
+	mu        sync.Mutex
+	entries   map[string]*entry[T]
+	idle      time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newStore[T any](idle time.Duration) *store[T] {
+	return &store[T]{
+		entries: map[string]*entry[T]{},
+		idle:    idle,
+		now:     time.Now,
+	}
+}
+
+// update runs fn on the state of key under the store's lock.
+func (s *store[T]) update(key string, fn func(state *T, isNew bool, now time.Time) Result) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= s.idle {
+		s.sweep(now)
+	}
+
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry[T]{}
+		s.entries[key] = e
+	}
+	e.lastSeen = now
+	return fn(&e.state, !ok, now)
+}
+
+func (s *store[T]) sweep(now time.Time) {
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if now.Sub(e.lastSeen) > s.idle {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// Len returns the number of keys being tracked.
+func (s *store[T]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucket allows bursts of up to burst requests, refilled at rate
+// requests per second.
+type TokenBucket struct {
+	*store[bucket]
+	rate  float64
+	burst int
+}
+
+// NewTokenBucket panics unless rate and burst are positive: a zero rate
+// never refills and a zero burst refuses every request.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if !(rate > 0) || math.IsInf(rate, 1) {
+		panic(fmt.Sprintf("ratelimit: invalid rate %v", rate))
+	}
+	if burst <= 0 {
+		panic(fmt.Sprintf("ratelimit: invalid burst %d", burst))
+	}
+	refill := time.Duration(float64(burst) / rate * float64(time.Second))
+	return &TokenBucket{
+		store: newStore[bucket](max(refill, time.Second)),
+		rate:  rate,
+		burst: burst,
+	}
+}
+
+func (tb *TokenBucket) Allow(key string) Result {
+	return tb.update(key, func(b *bucket, isNew bool, now time.Time) Result {
+		if isNew {
+			b.tokens = float64(tb.burst)
+		} else {
+			b.tokens = min(float64(tb.burst), b.tokens+now.Sub(b.last).Seconds()*tb.rate)
+		}
+		b.last = now
+
+		r := Result{Limit: tb.burst}
+		if b.tokens >= 1 {
+			b.tokens--
+			r.Allowed = true
+		} else {
+			r.RetryAfter = tb.wait(1 - b.tokens)
+		}
+		r.Remaining = int(b.tokens)
+		r.Reset = tb.wait(float64(tb.burst) - b.tokens)
+		return r
+	})
+}
+
+func (tb *TokenBucket) wait(tokens float64) time.Duration {
+	return time.Duration(tokens / tb.rate * float64(time.Second))
+}
+
+type window struct {
+	start      time.Time
+	prev, curr int
+}
+
+// SlidingWindow allows limit requests per window. It weighs the previous
+// fixed window's count by how much of it still overlaps the sliding one,
+// which smooths the bursts fixed windows allow at their edges.
+type SlidingWindow struct {
+	*store[window]
+	limit  int
+	window time.Duration
+}
+
+// NewSlidingWindow panics unless limit and d are positive.
+func NewSlidingWindow(limit int, d time.Duration) *SlidingWindow {
+	if limit <= 0 || d <= 0 {
+		panic(fmt.Sprintf("ratelimit: invalid limit %d per %v", limit, d))
+	}
+	return &SlidingWindow{
+		store:  newStore[window](2 * d),
+		limit:  limit,
+		window: d,
+	}
+}
+
+func (sw *SlidingWindow) Allow(key string) Result {
+	return sw.update(key, func(w *window, isNew bool, now time.Time) Result {
+		if isNew {
+			w.start = now.Truncate(sw.window)
+		}
+		if elapsed := now.Sub(w.start); elapsed >= sw.window {
+			n := int(elapsed / sw.window)
+			w.start = w.start.Add(time.Duration(n) * sw.window)
+			if n == 1 {
+				w.prev, w.curr = w.curr, 0
+			} else {
+				w.prev, w.curr = 0, 0
+			}
+		}
+
+		elapsed := now.Sub(w.start)
+		weight := 1 - float64(elapsed)/float64(sw.window)
+		estimate := float64(w.prev)*weight + float64(w.curr)
+
+		r := Result{Limit: sw.limit, Reset: sw.window - elapsed}
+		if estimate+1 <= float64(sw.limit) {
+			w.curr++
+			estimate++
+			r.Allowed = true
+		} else {
+			r.RetryAfter = sw.retryAfter(w, elapsed)
+		}
+		r.Remaining = max(0, sw.limit-int(math.Ceil(estimate)))
+		return r
+	})
+}
+
+// retryAfter is how long until the estimate leaves room for one request.
+func (sw *SlidingWindow) retryAfter(w *window, elapsed time.Duration) time.Duration {
+	room := float64(sw.limit - 1)
+	win := float64(sw.window)
+
+	if float64(w.curr) <= room && w.prev > 0 {
+		// The previous window's weight decays enough before this one ends.
+		f := 1 - (room-float64(w.curr))/float64(w.prev)
+		return time.Duration(f*win) - elapsed
+	}
+
+	// Wait for the next window, where the current count becomes the
+	// decaying one.
+	f := 0.0
+	if w.curr > 0 {
+		f = max(0, 1-room/float64(w.curr))
+	}
+	return sw.window - elapsed + time.Duration(f*win)
+}
@@ -0,0 +1,111 @@
+// Package ratelimit limits how often each client may send requests.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"httpFromTcp/internal/auth"
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+// KeyFunc returns the key a request is counted under.
+type KeyFunc func(*request.Request) string
+
+// ByIP counts requests per client IP.
+func ByIP(req *request.Request) string {
+	return "ip:" + req.RemoteIP()
+}
+
+// ByHeader counts requests per value of the named header, such as an API
+// key. Requests without it are counted per IP.
+//
+// The value is whatever the client sent, so a client rotating it gets a
+// fresh limit, and a new entry in the limiter, every time. Only use it
+// behind middleware that rejects requests whose header is not a known
+// credential; ByPrincipal is the safer choice with the auth package.
+func ByHeader(name string) KeyFunc {
+	return func(req *request.Request) string {
+		if v := req.Headers.Get(name); v != "" {
+			return "header:" + v
+		}
+		return ByIP(req)
+	}
+}
+
+// ByPrincipal counts requests per authenticated principal. Anonymous
+// requests are counted per IP. Place the limiter after the auth middleware.
+func ByPrincipal(req *request.Request) string {
+	if p, ok := auth.PrincipalFrom(req); ok {
+		return "principal:" + p.Scheme + ":" + p.Name
+	}
+	return ByIP(req)
+}
+
+type config struct {
+	key KeyFunc
+}
+
+type Option func(*config)
+
+// WithKey sets how requests are grouped. The default is ByIP.
+func WithKey(fn KeyFunc) Option {
+	return func(c *config) {
+		c.key = fn
+	}
+}
+
+// New returns a middleware refusing requests over limiter's limit with 429.
+// Every response carries RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers, and refusals a Retry-After header.
+func New(limiter Limiter, opts ...Option) server.Middleware {
+	c := &config{key: ByIP}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			r := limiter.Allow(c.key(req))
+
+			if !r.Allowed {
+				tooManyRequests(w, r)
+				return
+			}
+
+			w.OnHeaders(func(_ response.StatusCode, h headers.Headers) {
+				setHeaders(h, r)
+			})
+			next(w, req)
+		}
+	}
+}
+
+func tooManyRequests(w *response.Writer, r Result) {
+	status := response.TooManyRequests
+	body := fmt.Sprintf("%d %s\n", status, response.StatusText(status))
+	h := response.GetDefaultHeaders(len(body), "text/plain", false)
+	setHeaders(h, r)
+	h.Set("Retry-After", seconds(r.RetryAfter))
+
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody([]byte(body))
+}
+
+func setHeaders(h headers.Headers, r Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(r.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	h.Set("RateLimit-Reset", seconds(r.Reset))
+}
+
+// seconds rounds d up to whole seconds, so clients never retry early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/auth"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// newClock starts on a minute boundary, where sliding windows begin.
+func newClock() *clock { return &clock{time.Unix(1_699_999_980, 0)} }
+
+func TestTokenBucket(t *testing.T) {
+	c := newClock()
+	tb := NewTokenBucket(2, 3)
+	tb.now = c.now
+
+	// Test: Burst
+	for i := range 3 {
+		r := tb.Allow("a")
+		require.True(t, r.Allowed)
+		assert.Equal(t, 3, r.Limit)
+		assert.Equal(t, 2-i, r.Remaining)
+	}
+	r := tb.Allow("a")
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 500*time.Millisecond, r.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, r.Reset)
+
+	// Test: Keys are independent
+	assert.True(t, tb.Allow("b").Allowed)
+	assert.Equal(t, 2, tb.Len())
+
+	// Test: Refill
+	c.advance(500 * time.Millisecond)
+	assert.True(t, tb.Allow("a").Allowed)
+	assert.False(t, tb.Allow("a").Allowed)
+	c.advance(10 * time.Second)
+	r = tb.Allow("a")
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 2, r.Remaining)
+
+	// Test: Idle keys are evicted once their bucket would be full
+	c.advance(2 * time.Second)
+	tb.Allow("c")
+	assert.Equal(t, 1, tb.Len())
+
+	// Test: Limits that never allow or never refill are refused
+	assert.Panics(t, func() { NewTokenBucket(0, 1) })
+	assert.Panics(t, func() { NewTokenBucket(-1, 1) })
+	assert.Panics(t, func() { NewTokenBucket(math.NaN(), 1) })
+	assert.Panics(t, func() { NewTokenBucket(1, 0) })
+	assert.Panics(t, func() { NewSlidingWindow(0, time.Minute) })
+	assert.Panics(t, func() { NewSlidingWindow(1, 0) })
+}
+
+func TestSlidingWindow(t *testing.T) {
+	c := newClock()
+	sw := NewSlidingWindow(4, time.Minute)
+	sw.now = c.now
+
+	for i := range 4 {
+		r := sw.Allow("a")
+		require.True(t, r.Allowed)
+		assert.Equal(t, 3-i, r.Remaining)
+	}
+	r := sw.Allow("a")
+	assert.False(t, r.Allowed)
+	assert.Equal(t, time.Minute, r.Reset)
+	// 4 requests fill the window, the next one fits once a quarter of them
+	// slid out of it.
+	assert.Equal(t, time.Minute+15*time.Second, r.RetryAfter)
+
+	// Test: Previous window still weighs in
+	c.advance(time.Minute + 10*time.Second)
+	r = sw.Allow("a")
+	assert.False(t, r.Allowed)
+	assert.Equal(t, 5*time.Second, r.RetryAfter)
+
+	c.advance(5 * time.Second)
+	r = sw.Allow("a")
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 0, r.Remaining)
+
+	// Test: Counts reset after two idle windows
+	c.advance(2 * time.Minute)
+	r = sw.Allow("a")
+	assert.True(t, r.Allowed)
+	assert.Equal(t, 3, r.Remaining)
+
+	// Test: Idle keys are evicted
+	c.advance(3 * time.Minute)
+	sw.Allow("b")
+	assert.Equal(t, 1, sw.Len())
+}
+
+var ok server.Handler = func(w *response.Writer, req *request.Request) {
+	w.WriteStatusLine(response.Ok)
+	w.WriteHeaders(response.GetDefaultHeaders(2, "text/plain", false))
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody([]byte("ok"))
+}
+
+func serve(t *testing.T, handler server.Handler, remoteAddr string, header ...string) *response.Response {
+	t.Helper()
+	raw := "GET / HTTP/1.1\r\n"
+	for _, h := range header {
+		raw += h + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	req.RemoteAddr = remoteAddr
+
+	out := &bytes.Buffer{}
+	handler(&response.Writer{Writer: out, State: response.StatusLine}, req)
+	out.WriteString("\r\n")
+	r, err := response.ParseFromReader(out)
+	require.NoError(t, err)
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	c := newClock()
+	tb := NewTokenBucket(0.5, 2)
+	tb.now = c.now
+	handler := New(tb)(ok)
+
+	r := serve(t, handler, "10.0.0.1:5000")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, "2", r.Headers.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", r.Headers.Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", r.Headers.Get("RateLimit-Reset"))
+
+	// Test: Same IP on another port shares the bucket
+	serve(t, handler, "10.0.0.1:5001")
+	r = serve(t, handler, "10.0.0.1:5002")
+	assert.Equal(t, response.TooManyRequests, r.StatusLine.StatusCode)
+	assert.Equal(t, "2", r.Headers.Get("Retry-After"))
+	assert.Equal(t, "0", r.Headers.Get("RateLimit-Remaining"))
+	assert.Equal(t, "429 Too Many Requests\n", string(r.Body))
+
+	r = serve(t, handler, "10.0.0.2:5000")
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+}
+
+func TestKeys(t *testing.T) {
+	c := newClock()
+	tb := NewTokenBucket(1, 1)
+	tb.now = c.now
+
+	// Test: By header, falling back to IP
+	handler := New(tb, WithKey(ByHeader("X-Api-Key")))(ok)
+	assert.Equal(t, response.Ok, serve(t, handler, "10.0.0.1:1", "X-Api-Key: k1").StatusLine.StatusCode)
+	assert.Equal(t, response.TooManyRequests, serve(t, handler, "10.0.0.2:1", "X-Api-Key: k1").StatusLine.StatusCode)
+	assert.Equal(t, response.Ok, serve(t, handler, "10.0.0.1:1", "X-Api-Key: k2").StatusLine.StatusCode)
+	assert.Equal(t, response.Ok, serve(t, handler, "10.0.0.1:1").StatusLine.StatusCode)
+
+	// Test: By principal
+	users := auth.Users(map[string]string{"alice": "pw", "bob": "pw"})
+	handler = server.Chain(ok, auth.Basic("test", users), New(NewTokenBucket(1, 1), WithKey(ByPrincipal)))
+	alice := "Authorization: Basic YWxpY2U6cHc="
+	bob := "Authorization: Basic Ym9iOnB3"
+	assert.Equal(t, response.Ok, serve(t, handler, "10.0.0.1:1", alice).StatusLine.StatusCode)
+	assert.Equal(t, response.TooManyRequests, serve(t, handler, "10.0.0.9:1", alice).StatusLine.StatusCode)
+	assert.Equal(t, response.Ok, serve(t, handler, "10.0.0.1:1", bob).StatusLine.StatusCode)
+}
@@ -0,0 +1,114 @@
+package request
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	ErrBodyTooLarge        = errors.New("body too large")
+)
+
+// DecoderFunc returns a reader decompressing r.
+type DecoderFunc func(r io.Reader) (io.ReadCloser, error)
+
+// maxZstdWindow is the largest window a zstd body may ask the decoder to
+// allocate. RFC 9659 caps it at 8 MiB for HTTP.
+const maxZstdWindow = 8 << 20
+
+// DefaultDecoders are the content codings request bodies can be decoded from.
+var DefaultDecoders = map[string]DecoderFunc{
+	"gzip":   gzipDecoder,
+	"x-gzip": gzipDecoder,
+	"deflate": func(r io.Reader) (io.ReadCloser, error) {
+		return zlib.NewReader(r)
+	},
+	"br": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(brotli.NewReader(r)), nil
+	},
+	"zstd": zstdDecoder,
+}
+
+func gzipDecoder(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func zstdDecoder(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// DecodeBody undoes the Content-Encoding of the body using decoders, which
+// fall back to DefaultDecoders when nil. Decoding stops with ErrBodyTooLarge
+// once the output exceeds limit bytes, which protects against compression
+// bombs. On success Content-Encoding is removed and Content-Length updated.
+func (r *Request) DecodeBody(decoders map[string]DecoderFunc, limit int64) error {
+	ce := r.Headers.Get("Content-Encoding")
+	if ce == "" {
+		return nil
+	}
+	if decoders == nil {
+		decoders = DefaultDecoders
+	}
+	if _, err := r.ReadBody(); err != nil {
+		return err
+	}
+
+	codings := strings.Split(ce, ",")
+	body := r.Body
+	// Codings are listed in the order they were applied, so undo them
+	// from last to first.
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == "identity" || coding == "" {
+			continue
+		}
+
+		decoder, ok := decoders[coding]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnsupportedEncoding, coding)
+		}
+
+		decoded, err := decode(decoder, body, limit)
+		if err != nil {
+			return err
+		}
+		body = decoded
+	}
+
+	r.Body = body
+	r.Headers.Del("Content-Encoding")
+	r.Headers.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+func decode(decoder DecoderFunc, body []byte, limit int64) ([]byte, error) {
+	rc, err := decoder(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding body: %w", err)
+	}
+	defer rc.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding body: %w", err)
+	}
+	if int64(len(decoded)) > limit {
+		return nil, ErrBodyTooLarge
+	}
+
+	return decoded, nil
+}
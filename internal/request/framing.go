@@ -0,0 +1,91 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"httpFromTcp/internal/chunked"
+	"httpFromTcp/internal/headers"
+)
+
+// ErrUnsupportedTransferCoding is returned for a valid Transfer-Encoding
+// applying a coding other than chunked.
+var ErrUnsupportedTransferCoding = errors.New("unsupported transfer coding")
+
+// bodyFraming works out how the body is delimited once the headers are
+// parsed (RFC 9112 section 6.3). A proxy in front of the server may frame
+// an ambiguous message differently and smuggle a second request inside the
+// body, so such messages are rejected rather than guessed at.
+func (r *Request) bodyFraming() error {
+	te, chunkedBody := r.Headers["transfer-encoding"]
+	cl, hasLength := r.Headers["content-length"]
+
+	if host := r.Headers["host"]; strings.Contains(host, ",") {
+		return fmt.Errorf("multiple Host headers: %q", host)
+	}
+
+	switch {
+	case chunkedBody && hasLength:
+		return fmt.Errorf("both Transfer-Encoding and Content-Length are set")
+	case chunkedBody:
+		if err := checkTransferEncoding(te); err != nil {
+			return err
+		}
+		r.contentLength = -1
+		r.decoder = chunked.NewDecoder()
+	case hasLength:
+		n, err := parseContentLength(cl)
+		if err != nil {
+			return err
+		}
+		r.contentLength = n
+	}
+	return nil
+}
+
+// checkTransferEncoding accepts a coding list ending in chunked. Empty list
+// elements are refused too, since parsers disagree on them.
+func checkTransferEncoding(te string) error {
+	codings := strings.Split(te, ",")
+	for i, coding := range codings {
+		coding = strings.Trim(coding, " \t")
+		if !headers.IsToken(coding) {
+			return fmt.Errorf("invalid Transfer-Encoding: %q", te)
+		}
+
+		last := i == len(codings)-1
+		switch {
+		case strings.EqualFold(coding, "chunked") && !last:
+			return fmt.Errorf("chunked is applied more than once: %q", te)
+		case !strings.EqualFold(coding, "chunked") && last:
+			return fmt.Errorf("chunked is not the final transfer coding: %q", te)
+		case !last:
+			return fmt.Errorf("%w: %s", ErrUnsupportedTransferCoding, coding)
+		}
+	}
+	return nil
+}
+
+// parseContentLength accepts a decimal length. Repeated Content-Length
+// headers arrive joined as "a, b" and are only accepted if they all agree.
+func parseContentLength(cl string) (int, error) {
+	length := -1
+	for _, v := range strings.Split(cl, ",") {
+		v = strings.Trim(v, " \t")
+		if v == "" || strings.Trim(v, "0123456789") != "" {
+			return 0, fmt.Errorf("invalid Content-Length: %q", cl)
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid Content-Length: %q", cl)
+		}
+		if length != -1 && n != length {
+			return 0, fmt.Errorf("conflicting Content-Length values: %q", cl)
+		}
+		length = n
+	}
+	return length, nil
+}
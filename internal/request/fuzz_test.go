@@ -0,0 +1,146 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+
+	"httpFromTcp/internal/response"
+)
+
+var requestSeeds = []string{
+	"GET / HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
+	"GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+	"POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 13\r\n\r\nhello world!\n",
+	"POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 20\r\n\r\npartial content",
+	"POST /submit HTTP/1.1\r\nContent-Length: 2\r\n\r\n\r\n",
+	"POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello",
+	"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+	"GET / HTTP/1.1\r\nCookie: a=b; c=d\r\nAccept: text/html\r\nAccept: text/plain\r\n\r\n",
+	"GET / HTTP/1.1\r\n       Host : localhost:42069\r\n\r\n",
+	"GET / HTTP/1.1\r\nno colon\r\n\r\n",
+	"GET / HTTP/1.1\nHost: x\n\n",
+	"/coffee GET HTTP/1.1\r\n\r\n",
+}
+
+// FuzzRequestFromReader checks that parsing never panics, does not depend
+// on how the input is split into reads, keeps nothing larger than the input,
+// survives being written back out, and agrees with net/http on requests both
+// accept.
+func FuzzRequestFromReader(f *testing.F) {
+	for _, seed := range requestSeeds {
+		f.Add([]byte(seed), uint8(3))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, readSize uint8) {
+		r, err := RequestFromReader(&chunkReader{data: string(data), numBytesPerRead: int(readSize%32) + 1})
+		whole, wholeErr := RequestFromReader(bytes.NewReader(data))
+
+		if (err != nil) != (wholeErr != nil) {
+			t.Fatalf("result depends on read size: %v vs %v", err, wholeErr)
+		}
+		if err != nil {
+			return
+		}
+		if r.RequestLine != whole.RequestLine || !bytes.Equal(r.Body, whole.Body) || !equalHeaders(r.Headers, whole.Headers) {
+			t.Fatalf("result depends on read size: %+v vs %+v", r, whole)
+		}
+
+		size := len(r.Body) + len(r.RequestLine.Method) + len(r.RequestLine.RequestTarget)
+		for k, v := range r.Headers {
+			size += len(k) + len(v)
+		}
+		if size > len(data) {
+			t.Fatalf("parsed %d bytes out of %d bytes of input", size, len(data))
+		}
+
+		roundTrip(t, r)
+		compareWithNetHTTP(t, data, r)
+	})
+}
+
+// roundTrip writes r back out with response.Writer, as a proxy forwarding
+// it would, and checks that parsing the result gives the same request.
+func roundTrip(t *testing.T, r *Request) {
+	t.Helper()
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%s %s HTTP/%s\r\n", r.RequestLine.Method, r.RequestLine.RequestTarget, r.RequestLine.HTTPVersion)
+	w := &response.Writer{Writer: &out, State: response.Headers}
+	if err := w.WriteHeaders(r.Headers); err != nil {
+		t.Fatal(err)
+	}
+	out.WriteString("\r\n")
+	out.Write(r.Body)
+
+	again, err := RequestFromReader(&out)
+	if err != nil {
+		t.Fatalf("written back request fails to parse: %v", err)
+	}
+	// Whitespace around a value cannot be written back.
+	want := maps.Clone(r.Headers)
+	for k, v := range want {
+		want[k] = strings.Trim(v, " \t")
+	}
+	if again.RequestLine != r.RequestLine || !bytes.Equal(again.Body, r.Body) || !equalHeaders(want, again.Headers) {
+		t.Fatalf("round trip changed request: %+v, then %+v", r, again)
+	}
+}
+
+// compareWithNetHTTP parses data with net/http and checks the results agree
+// where both parsers accept the request.
+func compareWithNetHTTP(t *testing.T, data []byte, r *Request) {
+	t.Helper()
+	want, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return
+	}
+	body, err := io.ReadAll(want.Body)
+	if err != nil {
+		return
+	}
+
+	if r.RequestLine.Method != want.Method || r.RequestLine.RequestTarget != want.RequestURI {
+		t.Fatalf("request line %+v, net/http %s %s", r.RequestLine, want.Method, want.RequestURI)
+	}
+	// net/http moves Host out of the header map.
+	if want.Host != "" {
+		want.Header.Set("Host", want.Host)
+	}
+	for name, values := range want.Header {
+		// Empty values are not joined here, which only matters for
+		// list-valued fields where empty elements carry no meaning.
+		if got := r.Headers.Get(name); normalizeList(got) != normalizeList(strings.Join(values, ", ")) {
+			t.Fatalf("header %s = %q, net/http %q", name, got, values)
+		}
+	}
+	if !bytes.Equal(r.Body, body) {
+		t.Fatalf("body %q, net/http %q", r.Body, body)
+	}
+}
+
+func normalizeList(v string) string {
+	var out []string
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.Trim(e, " \t"); e != "" {
+			out = append(out, e)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+func equalHeaders(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
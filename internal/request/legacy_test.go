@@ -0,0 +1,98 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"httpFromTcp/internal/headers"
+)
+
+// legacyParseRequestLine is the string based parser parseRequestLine
+// replaced, kept as the reference for FuzzRequestLineEquivalence.
+func legacyParseRequestLine(request string) (*RequestLine, int, error) {
+	index := strings.Index(request, "\r\n")
+	if index == -1 {
+		return nil, 0, nil
+	}
+
+	startLine := request[:index]
+	read := index + len("\r\n")
+
+	parts := strings.Split(string(startLine), " ")
+	if len(parts) != 3 {
+		return nil, read, fmt.Errorf("too few parts in request line, parts: %d", len(parts))
+	}
+
+	method := parts[0]
+	target := parts[1]
+	versionParts := strings.Split(parts[2], "/")
+
+	if len(versionParts) != 2 {
+		return nil, read, fmt.Errorf("version parts too short; %s", versionParts)
+	}
+	version := versionParts[1]
+
+	if !IsUpper(method) {
+		return nil, read, fmt.Errorf("verb is not uppercase; %s", method)
+	}
+
+	if string(version) != "1.1" {
+		return nil, read, fmt.Errorf("wrong version number: %s", string(version))
+	}
+
+	return &RequestLine{
+		HTTPVersion:   string(version),
+		RequestTarget: target,
+		Method:        method,
+	}, read, nil
+}
+
+func FuzzRequestLineEquivalence(f *testing.F) {
+	for _, seed := range []string{
+		"GET / HTTP/1.1\r\n",
+		"GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		"/coffee HTTP/1.1\r\n",
+		"/coffee GET HTTP/1.1\r\n",
+		"GET /coffee HTTP/2.1\r\n",
+		"get / HTTP/1.1\r\n",
+		"G3T / HTTP/1.1\r\n",
+		"GÉT / HTTP/1.1\r\n",
+		"Gét / HTTP/1.1\r\n",
+		"GET  / HTTP/1.1\r\n",
+		"GET / HTTP/1.1 \r\n",
+		"GET / XYZ/1.1\r\n",
+		"GET / HTTP/1/1\r\n",
+		"GET / HTTP1.1\r\n",
+		"GET / HTTP/1.1",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		got, n, err := parseRequestLine(data)
+		want, wantN, wantErr := legacyParseRequestLine(string(data))
+
+		// Control characters, bare LF among them, are rejected now.
+		line, _, _ := bytes.Cut(data, crlf)
+		if err != nil && wantErr == nil && bytes.ContainsFunc(line, func(r rune) bool { return r < ' ' || r == 0x7f }) {
+			return
+		}
+		// So are protocol names other than HTTP.
+		if err != nil && wantErr == nil && !bytes.Contains(line, []byte(" HTTP/")) {
+			return
+		}
+		// And methods that are not tokens, or empty targets.
+		if err != nil && wantErr == nil && (!headers.IsToken(want.Method) || want.RequestTarget == "") {
+			return
+		}
+
+		if n != wantN || (err != nil) != (wantErr != nil) {
+			t.Fatalf("input %q: got (%d, %v), legacy (%d, %v)", data, n, err, wantN, wantErr)
+		}
+		if (got == nil) != (want == nil) || got != nil && *got != *want {
+			t.Fatalf("input %q: got %+v, legacy %+v", data, got, want)
+		}
+	})
+}
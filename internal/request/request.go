@@ -2,13 +2,21 @@
 package request
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"strconv"
-	"strings"
+	"sync"
 	"unicode"
+	"unicode/utf8"
 
+	"httpFromTcp/internal/chunked"
+	"httpFromTcp/internal/cookie"
 	"httpFromTcp/internal/headers"
 )
 
@@ -17,6 +25,30 @@ type Request struct {
 	State       parsesState
 	Headers     headers.Headers
 	Body        []byte
+	// Trailers holds the trailer fields of a chunked body.
+	Trailers headers.Headers
+
+	// RemoteAddr is the network address of the client that sent the request.
+	RemoteAddr string
+
+	// TLS is the state of the connection the request arrived on, or nil for
+	// plain TCP connections.
+	TLS *tls.ConnectionState
+
+	ctx         context.Context
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+	headSize    int
+	eof         bool
+	beforeBody  func() error
+
+	contentLength int
+	decoder       *chunked.Decoder
+	maxBodySize   int64
+
+	// pooled is where buf came from when it was taken from bufPool.
+	pooled *[]byte
 }
 
 type parsesState string
@@ -35,69 +67,296 @@ type RequestLine struct {
 }
 
 var (
-	bufferSize = 8
-	crlf       = "\r\n"
+	crlf  = []byte("\r\n")
+	space = []byte(" ")
 )
 
-var ErrMalformedRequestLine = fmt.Errorf("malformed http request line")
+const (
+	bufferSize      = 1024
+	maxPooledBuffer = 64 << 10
+	// maxHeadSize bounds the request line and headers together, so a
+	// client cannot grow the buffer by never ending a line.
+	maxHeadSize = 64 << 10
+)
+
+// bufPool holds parse buffers for RequestHeadFromReader. A buffer goes back
+// once its request is fully read, the body having been copied out of it.
+var bufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, bufferSize)
+		return &buf
+	},
+}
+
+var (
+	ErrMalformedRequestLine = fmt.Errorf("malformed http request line")
+	// ErrInvalidFraming is returned when the length of the body cannot be
+	// determined safely from the headers.
+	ErrInvalidFraming = errors.New("invalid message framing")
+	// ErrMalformedRequest wraps every error caused by invalid request
+	// syntax, as opposed to errors reading from the connection.
+	ErrMalformedRequest = errors.New("malformed request")
+	// ErrHeadTooLarge is returned, wrapped in ErrMalformedRequest, when the
+	// request line and headers exceed maxHeadSize, or the trailers of a
+	// chunked body the same limit.
+	ErrHeadTooLarge = errors.New("request head too large")
+)
 
 func (r *Request) done() bool {
 	return r.State == StateDone
 }
 
+// inHead reports whether the request line or headers are still being read.
+func (r *Request) inHead() bool {
+	return r.State == StateInit || r.State == StateHeadersInit
+}
+
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	r := &Request{
-		RequestLine{},
-		StateInit,
-		headers.Headers{},
-		nil,
+	r, err := RequestHeadFromReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.ReadBody(); err != nil {
+		return nil, err
 	}
 
-	buf := make([]byte, bufferSize)
-	readToIndex := 0
-	for !r.done() {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
+	return r, nil
+}
+
+// RequestHeadFromReader reads the request line and headers and leaves the
+// body unread until ReadBody is called.
+func RequestHeadFromReader(reader io.Reader) (*Request, error) {
+	bufp := bufPool.Get().(*[]byte)
+	return readHead(&Request{
+		State:   StateInit,
+		Headers: headers.Headers{},
+		reader:  reader,
+		buf:     (*bufp)[:cap(*bufp)],
+		pooled:  bufp,
+	})
+}
+
+// RequestHeadWithBuffer is RequestHeadFromReader parsing into buf instead
+// of a buffer from the package's pool, leaving its size and lifetime to the
+// caller. The body is copied out of buf, so buf can be reused once
+// ReleaseBuffer returns it.
+func RequestHeadWithBuffer(reader io.Reader, buf []byte) (*Request, error) {
+	if cap(buf) < bufferSize {
+		buf = make([]byte, bufferSize)
+	}
+	return readHead(&Request{
+		State:   StateInit,
+		Headers: headers.Headers{},
+		reader:  reader,
+		buf:     buf[:cap(buf)],
+	})
+}
+
+func readHead(r *Request) (*Request, error) {
+	err := r.readUntil(func() bool {
+		return r.State == StateBodyInit || r.done()
+	})
+	if err != nil {
+		r.releasePooled()
+		return nil, err
+	}
+	if r.done() {
+		r.releasePooled()
+	}
+
+	return r, nil
+}
+
+// releasePooled returns a buffer taken from bufPool.
+func (r *Request) releasePooled() {
+	if r.pooled == nil {
+		return
+	}
+	if cap(r.buf) <= maxPooledBuffer {
+		*r.pooled = r.buf[:cap(r.buf)]
+		bufPool.Put(r.pooled)
+	}
+	r.pooled = nil
+	r.buf = nil
+	r.readToIndex = 0
+}
+
+// ReleaseBuffer detaches the parse buffer from the request and returns it,
+// possibly grown. The request must not be read from afterwards.
+func (r *Request) ReleaseBuffer() []byte {
+	buf := r.buf
+	r.buf = nil
+	r.readToIndex = 0
+	return buf[:0]
+}
+
+// BeforeBodyRead registers fn to run once, right before the body is read
+// from the connection. The server uses it to send 100 Continue only when a
+// handler actually wants the body.
+func (r *Request) BeforeBodyRead(fn func() error) {
+	r.beforeBody = fn
+}
+
+// ReadBody reads the rest of the request and returns its body. It is safe to
+// call more than once.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.done() {
+		return r.Body, nil
+	}
+
+	if r.beforeBody != nil {
+		fn := r.beforeBody
+		r.beforeBody = nil
+		if err := fn(); err != nil {
+			return nil, err
 		}
+	}
+
+	err := r.readUntil(r.done)
+	r.releasePooled()
+	if err != nil {
+		return nil, err
+	}
 
-		readN, err := reader.Read(buf[readToIndex:])
+	return r.Body, nil
+}
+
+// ContentLength returns the length of the body, or -1 for a chunked body
+// that has not been read yet.
+func (r *Request) ContentLength() int {
+	return r.contentLength
+}
+
+// SetMaxBodySize makes reading a chunked body fail with ErrBodyTooLarge once
+// it grows past n bytes. Bodies with a Content-Length are checked before
+// reading by the caller.
+func (r *Request) SetMaxBodySize(n int64) {
+	r.maxBodySize = n
+}
+
+// readUntil parses buffered data and reads more from the connection until
+// stop returns true. Data read past that point stays buffered for the next
+// call.
+func (r *Request) readUntil(stop func() bool) error {
+	for {
+		inHead := r.inHead()
+		parsedN, err := r.parse(r.buf[:r.readToIndex], stop)
 		if err != nil {
-			if err == io.EOF {
-				r.State = StateDone
-				break
-			} else {
-				log.Fatal("error when reading", "error", err, readN)
+			if errors.Is(err, ErrBodyTooLarge) {
+				return err
+			}
+			return fmt.Errorf("%w: %w", ErrMalformedRequest, err)
+		}
+
+		copy(r.buf, r.buf[parsedN:r.readToIndex])
+		r.readToIndex -= parsedN
+
+		if inHead {
+			// Unparsed data counts too while the head is incomplete, since
+			// it can only be the rest of the head.
+			r.headSize += parsedN
+			if size := r.headSize; size > maxHeadSize || r.inHead() && size+r.readToIndex > maxHeadSize {
+				return fmt.Errorf("%w: %w: more than %d bytes", ErrMalformedRequest, ErrHeadTooLarge, maxHeadSize)
+			}
+		}
+
+		if stop() {
+			return nil
+		}
+		if r.eof {
+			if r.inHead() {
+				if r.State == StateInit && r.readToIndex == 0 {
+					return io.EOF
+				}
+				return fmt.Errorf("%w: request head is incomplete", io.ErrUnexpectedEOF)
 			}
+			return fmt.Errorf("%w: request body is incomplete", io.ErrUnexpectedEOF)
 		}
 
-		readToIndex += readN
+		if r.readToIndex >= len(r.buf) {
+			newBuf := make([]byte, len(r.buf)*2)
+			copy(newBuf, r.buf)
+			r.buf = newBuf
+		}
 
-		parsedN, err := r.parse(buf[:readToIndex])
+		readN, err := r.reader.Read(r.buf[r.readToIndex:])
+		r.readToIndex += readN
 		if err != nil {
-			return nil, fmt.Errorf("error while parsing request, %s", err)
+			if err == io.EOF {
+				r.eof = true
+			} else {
+				return fmt.Errorf("reading request: %w", err)
+			}
 		}
+	}
+}
 
-		copy(buf, buf[parsedN:readToIndex])
-		readToIndex -= parsedN
+// Context returns the request's context. It is never nil.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
 	}
+	return r.ctx
+}
+
+// SetContext replaces the request's context. Middleware uses it to pass
+// values such as sessions or principals down to handlers.
+func (r *Request) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
 
-	contentLength, _ := r.getContentLegth()
-	if len(r.Body) == 0 && contentLength > 0 {
-		return nil, fmt.Errorf("content length does not match body, cl: %d, body: %d", len(r.Body), contentLength)
+// RemoteIP returns the host part of RemoteAddr.
+func (r *Request) RemoteIP() string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
+	return host
+}
 
-	return r, nil
+// Cookies parses the Cookie header.
+func (r *Request) Cookies() []*cookie.Cookie {
+	return cookie.Parse(r.Headers.Get("Cookie"))
 }
 
-func (r *Request) parse(data []byte) (int, error) {
+// Cookie returns the first cookie called name.
+func (r *Request) Cookie(name string) (*cookie.Cookie, bool) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// PeerCertificates returns the verified client certificate chain, leaf first.
+// It is nil unless the client presented a certificate that was verified
+// against the server's client CA pool.
+func (r *Request) PeerCertificates() []*x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0]
+}
+
+// ClientSubject returns the subject of the verified client certificate, or an
+// empty string if there is none.
+func (r *Request) ClientSubject() string {
+	chain := r.PeerCertificates()
+	if len(chain) == 0 {
+		return ""
+	}
+	return chain[0].Subject.String()
+}
+
+func (r *Request) parse(data []byte, stop func() bool) (int, error) {
 	if r.done() {
 		return 0, fmt.Errorf("trying to read data in done state")
 	}
 
 	parsedBytes := 0
-	for r.State != StateDone {
+	for r.State != StateDone && !stop() {
 		n, err := r.parseSingle(data[parsedBytes:])
 		if err != nil {
 			return 0, err
@@ -115,112 +374,169 @@ func (r *Request) parse(data []byte) (int, error) {
 func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.State {
 	case StateInit:
-		reqLine, bytes, err := parseRequestLine(string(data))
+		reqLine, n, err := parseRequestLine(data)
 		if err != nil {
-			return bytes, err
+			return n, err
 		}
 
-		if bytes == 0 {
+		if n == 0 {
 			return 0, nil
 		}
 
 		r.State = StateHeadersInit
 		r.RequestLine = *reqLine
-		return bytes, nil
+		return n, nil
 
 	case StateHeadersInit:
+		// A line starting with whitespace is an obsolete line folding, or
+		// whitespace before the first header. Proxies read either as part
+		// of the previous line or as a header of its own.
+		if len(data) > 0 && (data[0] == ' ' || data[0] == '\t') {
+			return 0, fmt.Errorf("%w, line starts with whitespace", headers.ErrMalformedHeader)
+		}
+
 		headerN, done, err := r.Headers.Parse(data)
 		if err != nil {
 			return 0, err
 		}
 
 		if done {
+			if err := r.bodyFraming(); err != nil {
+				return 0, fmt.Errorf("%w: %w", ErrInvalidFraming, err)
+			}
 			r.State = StateBodyInit
 			return headerN, nil
 		}
 
 		return headerN, nil
 	case StateBodyInit:
-		contentLength, err := r.getContentLegth()
-		if err != nil {
-			return 0, err
+		if r.decoder != nil {
+			return r.parseChunked(data)
 		}
 
-		if contentLength == 0 {
+		if r.contentLength == 0 {
 			r.State = StateDone
 			return 0, nil
 		}
 
-		if len(data) >= len(crlf) {
-			if string(data[:len(crlf)]) == crlf {
-				return len(crlf), nil
-			}
-		}
-
-		if len(data) < contentLength {
+		if len(data) < r.contentLength {
 			return 0, nil
 		}
 
-		if len(data) > contentLength {
-			return 0, fmt.Errorf("body is too long")
-		}
-
+		// Anything past Content-Length belongs to the next request. data
+		// lives in a buffer that is reused for other requests.
 		r.State = StateDone
-		r.Body = data
-		return len(data), nil
+		r.Body = bytes.Clone(data[:r.contentLength])
+		return r.contentLength, nil
 
 	default:
 		return 0, fmt.Errorf("unexpected state")
 	}
 }
 
-func (r *Request) getContentLegth() (int, error) {
-	contentLengthStr := r.Headers.Get("Content-Length")
-	contentLength, err := strconv.Atoi(contentLengthStr)
+// parseChunked feeds data to the chunked decoder. Once the body is complete
+// the request is made to look as if it had been sent with a Content-Length.
+func (r *Request) parseChunked(data []byte) (int, error) {
+	n, done, err := r.decoder.Parse(data)
+	if errors.Is(err, chunked.ErrTrailersTooLarge) {
+		return 0, fmt.Errorf("%w: %w", ErrHeadTooLarge, err)
+	}
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
-	return contentLength, nil
+	if r.maxBodySize > 0 && int64(len(r.decoder.Body)) > r.maxBodySize {
+		return 0, fmt.Errorf("%w: chunked body is larger than %d bytes", ErrBodyTooLarge, r.maxBodySize)
+	}
+	if !done {
+		return n, nil
+	}
+
+	r.State = StateDone
+	r.Body = r.decoder.Body
+	r.Trailers = r.decoder.Trailers
+	r.contentLength = len(r.Body)
+	r.decoder = nil
+	r.Headers.Del("Transfer-Encoding")
+	r.Headers.Set("Content-Length", strconv.Itoa(r.contentLength))
+	return n, nil
 }
 
-func parseRequestLine(request string) (*RequestLine, int, error) {
-	index := strings.Index(request, "\r\n")
+func parseRequestLine(data []byte) (*RequestLine, int, error) {
+	index := bytes.Index(data, crlf)
 	if index == -1 {
 		return nil, 0, nil
 	}
 
-	startLine := request[:index]
-	read := index + len("\r\n")
+	line := data[:index]
+	read := index + len(crlf)
 
-	parts := strings.Split(string(startLine), " ")
-	if len(parts) != 3 {
-		return nil, read, fmt.Errorf("too few parts in request line, parts: %d", len(parts))
+	for _, c := range line {
+		if c < ' ' || c == 0x7f {
+			return nil, read, fmt.Errorf("%w: control character in request line: %q", ErrMalformedRequestLine, line)
+		}
 	}
 
-	method := parts[0]
-	target := parts[1]
-	versionParts := strings.Split(parts[2], "/")
+	method, rest, _ := bytes.Cut(line, space)
+	target, version, ok := bytes.Cut(rest, space)
+	if !ok || bytes.IndexByte(version, ' ') != -1 {
+		return nil, read, fmt.Errorf("%w: too few parts in request line, parts: %d", ErrMalformedRequestLine, bytes.Count(line, space)+1)
+	}
 
-	if len(versionParts) != 2 {
-		return nil, read, fmt.Errorf("version parts too short; %s", versionParts)
+	version, ok = bytes.CutPrefix(version, []byte("HTTP/"))
+	if !ok {
+		return nil, read, fmt.Errorf("%w: version does not start with HTTP/; %q", ErrMalformedRequestLine, version)
 	}
-	version := versionParts[1]
 
-	if !IsUpper(method) {
-		return nil, read, fmt.Errorf("verb is not uppercase; %s", method)
+	if !headers.IsToken(string(method)) {
+		return nil, read, fmt.Errorf("%w: method is not a token; %q", ErrMalformedRequestLine, method)
+	}
+	if !isUpper(method) {
+		return nil, read, fmt.Errorf("%w: verb is not uppercase; %q", ErrMalformedRequestLine, method)
+	}
+	if len(target) == 0 {
+		return nil, read, fmt.Errorf("%w: empty request target", ErrMalformedRequestLine)
 	}
 
 	if string(version) != "1.1" {
-		return nil, read, fmt.Errorf("wrong version number: %s", string(version))
+		return nil, read, fmt.Errorf("%w: wrong version number: %q", ErrMalformedRequestLine, version)
 	}
 
 	return &RequestLine{
-		HTTPVersion:   string(version),
-		RequestTarget: target,
-		Method:        method,
+		HTTPVersion:   "1.1",
+		RequestTarget: string(target),
+		Method:        internMethod(method),
 	}, read, nil
 }
 
+// isUpper is IsUpper without converting ASCII input to a string.
+func isUpper(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return IsUpper(string(b))
+		}
+		if 'a' <= c && c <= 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+var methods = map[string]string{}
+
+func init() {
+	for _, m := range []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"} {
+		methods[m] = m
+	}
+}
+
+// internMethod returns standard methods without allocating.
+func internMethod(b []byte) string {
+	if m, ok := methods[string(b)]; ok {
+		return m
+	}
+	return string(b)
+}
+
 func IsUpper(s string) bool {
 	for _, r := range s {
 		if !unicode.IsUpper(r) && unicode.IsLetter(r) {
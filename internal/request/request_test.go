@@ -1,9 +1,13 @@
 package request
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -45,6 +49,28 @@ func TestRequestLineParse(t *testing.T) {
 	// Test: Invalid version
 	_, err = RequestFromReader(strings.NewReader("GET /coffee HTTP/2.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n"))
 	require.Error(t, err)
+
+	// Test: Invalid protocol name
+	_, err = RequestFromReader(strings.NewReader("GET / XTTP/1.1\r\n\r\n"))
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+
+	// Test: Empty or non-token methods and empty targets
+	for _, line := range []string{
+		" / HTTP/1.1",
+		"G(T / HTTP/1.1",
+		"GET\"/ / HTTP/1.1",
+		"GÉT / HTTP/1.1",
+		"GET  HTTP/1.1",
+	} {
+		_, err = RequestFromReader(strings.NewReader(line + "\r\nHost: localhost\r\n\r\n"))
+		require.ErrorIs(t, err, ErrMalformedRequest, line)
+		require.ErrorIs(t, err, ErrMalformedRequestLine, line)
+	}
+
+	// Test: Extension methods made of token characters
+	r, err = RequestFromReader(strings.NewReader("M-SEARCH * HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "M-SEARCH", r.RequestLine.Method)
 }
 
 func TestHeadersParse(t *testing.T) {
@@ -139,6 +165,33 @@ func TestBodyParse(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, r)
 
+	// Test: Body starting with CRLF
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 4\r\n\r\n\r\nab"))
+	require.NoError(t, err)
+	assert.Equal(t, "\r\nab", string(r.Body))
+
+	// Test: Bytes past the content length are left unread
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabcGET / HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(r.Body))
+	r, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nabcdef"))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(r.Body))
+
+	// Test: Negative content length
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: -5\r\n\r\nabc"))
+	require.ErrorIs(t, err, ErrMalformedRequest)
+
+	// Test: Truncated head
+	_, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: localhost"))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = RequestFromReader(strings.NewReader(""))
+	require.ErrorIs(t, err, io.EOF)
+
 	// Test: body but no content length
 	reader = &chunkReader{
 		data: "POST /submit HTTP/1.1\r\n" +
@@ -152,6 +205,65 @@ func TestBodyParse(t *testing.T) {
 	require.NotNil(t, r)
 }
 
+func TestCookies(t *testing.T) {
+	// Test: Cookies by name
+	r, err := RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nCookie: session=abc; theme=dark\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Len(t, r.Cookies(), 2)
+	c, ok := r.Cookie("theme")
+	require.True(t, ok)
+	assert.Equal(t, "dark", c.Value)
+	_, ok = r.Cookie("missing")
+	assert.False(t, ok)
+
+	// Test: No cookie header
+	r, err = RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Empty(t, r.Cookies())
+}
+
+func TestReadError(t *testing.T) {
+	reset := errors.New("connection reset by peer")
+	reader := io.MultiReader(strings.NewReader("GET / HTTP/1.1\r\nHost: x"), iotest.ErrReader(reset))
+
+	_, err := RequestFromReader(reader)
+	require.ErrorIs(t, err, reset)
+	assert.NotErrorIs(t, err, ErrMalformedRequest)
+}
+
+func TestHeadTooLarge(t *testing.T) {
+	// Test: A line that never ends
+	_, err := RequestFromReader(strings.NewReader("GET /" + strings.Repeat("a", maxHeadSize)))
+	require.ErrorIs(t, err, ErrHeadTooLarge)
+	require.ErrorIs(t, err, ErrMalformedRequest)
+
+	// Test: Many short headers
+	var head strings.Builder
+	head.WriteString("GET / HTTP/1.1\r\n")
+	for head.Len() <= maxHeadSize {
+		head.WriteString("X-Filler: aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\r\n")
+	}
+	_, err = RequestFromReader(&chunkReader{data: head.String() + "\r\n", numBytesPerRead: 4096})
+	require.ErrorIs(t, err, ErrHeadTooLarge)
+
+	// Test: Huge trailers are cut off early, whatever the body size limit
+	trailers := strings.Repeat("X-Trailer: aaaaaaaaaaaaaaaaaaaaaaaaaa\r\n", 8<<20/40)
+	start := time.Now()
+	r, err := RequestHeadFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n" + trailers + "\r\n"))
+	require.NoError(t, err)
+	r.SetMaxBodySize(1024)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrHeadTooLarge)
+	require.ErrorIs(t, err, ErrMalformedRequest)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Test: The body does not count
+	body := strings.Repeat("b", 2*maxHeadSize)
+	r, err = RequestFromReader(strings.NewReader(fmt.Sprintf("POST / HTTP/1.1\r\nContent-Length: %d\r\n\r\n%s", len(body), body)))
+	require.NoError(t, err)
+	assert.Equal(t, body, string(r.Body))
+}
+
 type chunkReader struct {
 	data            string
 	numBytesPerRead int
@@ -173,3 +285,62 @@ func (cr *chunkReader) Read(p []byte) (n int, err error) {
 
 	return n, nil
 }
+
+func TestRemoteIP(t *testing.T) {
+	r := &Request{RemoteAddr: "127.0.0.1:42069"}
+	assert.Equal(t, "127.0.0.1", r.RemoteIP())
+
+	r.RemoteAddr = "[::1]:42069"
+	assert.Equal(t, "::1", r.RemoteIP())
+
+	// Test: No port
+	r.RemoteAddr = "pipe"
+	assert.Equal(t, "pipe", r.RemoteIP())
+}
+
+func TestRequestHeadWithBuffer(t *testing.T) {
+	buf := make([]byte, 16)
+	raw := "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 11\r\n\r\nhello world"
+
+	r, err := RequestHeadWithBuffer(&chunkReader{data: raw, numBytesPerRead: 5}, buf)
+	require.NoError(t, err)
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello world", string(body))
+
+	// Test: Body survives reuse of the buffer
+	buf = r.ReleaseBuffer()
+	assert.Empty(t, buf)
+	assert.GreaterOrEqual(t, cap(buf), 16)
+	r, err = RequestHeadWithBuffer(strings.NewReader("POST / HTTP/1.1\r\nContent-Length: 3\r\n\r\nbye"), buf)
+	require.NoError(t, err)
+	next, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "bye", string(next))
+	assert.Equal(t, "hello world", string(body))
+}
+
+var benchRequest = "GET /coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\nAccept-Encoding: gzip, deflate\r\nConnection: close\r\n\r\n"
+
+func BenchmarkRequestHead(b *testing.B) {
+	b.Run("pooled-buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := RequestHeadFromReader(strings.NewReader(benchRequest)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reused-buffer", func(b *testing.B) {
+		buf := make([]byte, 4096)
+		b.ReportAllocs()
+		for b.Loop() {
+			r, err := RequestHeadWithBuffer(strings.NewReader(benchRequest), buf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf = r.ReleaseBuffer()
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package request
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smugglingPayloads are requests a proxy and this server could disagree on
+// the length of. Each one must be rejected, or read exactly as intended.
+var smugglingPayloads = []struct {
+	name string
+	raw  string
+	// err is nil when the request is valid and body is what must be read.
+	err  error
+	body string
+}{
+	// CL.TE and TE.CL: one side trusts Content-Length, the other
+	// Transfer-Encoding.
+	{"CL.TE", "POST / HTTP/1.1\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nSMUGGLED", ErrMalformedRequest, ""},
+	{"TE.CL", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n8\r\nSMUGGLED\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+
+	// TE.TE: an obfuscated Transfer-Encoding one side ignores.
+	{"TE with space before colon", "POST / HTTP/1.1\r\nTransfer-Encoding : chunked\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE with leading space", "POST / HTTP/1.1\r\nHost: x\r\n Transfer-Encoding: chunked\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE folded", "POST / HTTP/1.1\r\nTransfer-Encoding:\r\n chunked\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE with tab before value", "POST / HTTP/1.1\r\nTransfer-Encoding:\tchunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", nil, "hello"},
+	{"TE unknown coding", "POST / HTTP/1.1\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE chunked not last", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked, identity\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE chunked twice", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked, chunked\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE duplicated header", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: x\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE empty element", "POST / HTTP/1.1\r\nTransfer-Encoding: , chunked\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE empty then chunked", "POST / HTTP/1.1\r\nTransfer-Encoding:\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE empty", "POST / HTTP/1.1\r\nTransfer-Encoding:\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE with parameter", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked;q=1\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE with vertical tab", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\v\r\n\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"TE other coding first", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", ErrUnsupportedTransferCoding, ""},
+	{"TE mixed case", "POST / HTTP/1.1\r\nTransfer-Encoding: ChUnKeD\r\n\r\n5\r\nhello\r\n0\r\n\r\n", nil, "hello"},
+
+	// CL.CL: Content-Length values that parse differently.
+	{"CL differing duplicates", "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\nhello!", ErrMalformedRequest, ""},
+	{"CL identical duplicates", "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello", nil, "hello"},
+	{"CL list", "POST / HTTP/1.1\r\nContent-Length: 5, 6\r\n\r\nhello!", ErrMalformedRequest, ""},
+	{"CL with sign", "POST / HTTP/1.1\r\nContent-Length: +5\r\n\r\nhello", ErrMalformedRequest, ""},
+	{"CL negative", "POST / HTTP/1.1\r\nContent-Length: -1\r\n\r\n", ErrMalformedRequest, ""},
+	{"CL hex", "POST / HTTP/1.1\r\nContent-Length: 0x5\r\n\r\nhello", ErrMalformedRequest, ""},
+	{"CL with inner space", "POST / HTTP/1.1\r\nContent-Length: 1 5\r\n\r\nhello", ErrMalformedRequest, ""},
+	{"CL empty then set", "POST / HTTP/1.1\r\nContent-Length: \r\nContent-Length: 5\r\n\r\nhello", ErrMalformedRequest, ""},
+	{"CL with tab", "POST / HTTP/1.1\r\nContent-Length:\t5\t\r\n\r\nhello", nil, "hello"},
+	{"CL empty", "POST / HTTP/1.1\r\nContent-Length:\r\n\r\n", ErrMalformedRequest, ""},
+	{"CL overflow", "POST / HTTP/1.1\r\nContent-Length: 99999999999999999999\r\n\r\n", ErrMalformedRequest, ""},
+	{"CL leading zeros", "POST / HTTP/1.1\r\nContent-Length: 005\r\n\r\nhello", nil, "hello"},
+
+	// Line endings and control characters.
+	{"bare LF in request line", "GET / HTTP/1.1\nContent-Length: 5\r\n\r\nhello", ErrMalformedRequest, ""},
+	{"bare LF between headers", "POST / HTTP/1.1\r\nX-Foo: a\nContent-Length: 5\r\n\r\nhello", ErrMalformedRequest, ""},
+	{"bare LF ending headers", "POST / HTTP/1.1\r\nContent-Length: 5\n\nhello\r\n\r\n", ErrMalformedRequest, ""},
+	{"bare CR in header", "POST / HTTP/1.1\r\nX-Foo: a\rContent-Length: 5\r\n\r\nhello", ErrMalformedRequest, ""},
+	{"NUL in header", "POST / HTTP/1.1\r\nX-Foo: a\x00b\r\n\r\n", ErrMalformedRequest, ""},
+	{"NUL in request target", "GET /\x00 HTTP/1.1\r\n\r\n", ErrMalformedRequest, ""},
+	{"bare LF in chunk extension", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;a\nb\r\nhello\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"bare LF after chunk size", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\nhello\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"chunk size with prefix", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0x5\r\nhello\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+	{"chunk data overrun", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nhello\r\n0\r\n\r\n", ErrMalformedRequest, ""},
+
+	// Host confusion.
+	{"multiple Host headers", "GET / HTTP/1.1\r\nHost: a.example\r\nHost: b.example\r\n\r\n", ErrMalformedRequest, ""},
+	{"empty Host then Host", "GET / HTTP/1.1\r\nHost: \r\nHost: evil.example\r\n\r\n", ErrMalformedRequest, ""},
+}
+
+func TestSmugglingPayloads(t *testing.T) {
+	for _, tc := range smugglingPayloads {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, readSize := range []int{1, 3, len(tc.raw)} {
+				r, err := RequestFromReader(&chunkReader{data: tc.raw, numBytesPerRead: readSize})
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+					continue
+				}
+				require.NoError(t, err)
+				assert.Equal(t, tc.body, string(r.Body))
+			}
+		})
+	}
+}
+
+func TestChunkedBody(t *testing.T) {
+	raw := "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nTrailer: X-Sum\r\n\r\n" +
+		"5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\nX-Sum: abc\r\n\r\nGET / HTTP/1.1\r\n\r\n"
+
+	r, err := RequestHeadFromReader(&chunkReader{data: raw, numBytesPerRead: 4})
+	require.NoError(t, err)
+	assert.Equal(t, -1, r.ContentLength())
+
+	body, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", string(body))
+	assert.Equal(t, "abc", r.Trailers.Get("X-Sum"))
+	assert.Equal(t, 12, r.ContentLength())
+	assert.Equal(t, "12", r.Headers.Get("Content-Length"))
+	assert.Empty(t, r.Headers.Get("Transfer-Encoding"))
+
+	// Test: Incomplete chunked body
+	_, err = RequestFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhel"))
+	require.Error(t, err)
+
+	// Test: Chunked body over the size limit
+	r, err = RequestHeadFromReader(strings.NewReader("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n5\r\nworld\r\n0\r\n\r\n"))
+	require.NoError(t, err)
+	r.SetMaxBodySize(8)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
@@ -0,0 +1,380 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"httpFromTcp/internal/chunked"
+	"httpFromTcp/internal/headers"
+)
+
+// Response is a response read from a server, the counterpart of
+// request.Request.
+type Response struct {
+	StatusLine Status
+	State      parseState
+	Headers    headers.Headers
+	Body       []byte
+	Trailers   headers.Headers
+	// SetCookies holds each Set-Cookie field apart, since cookie values may
+	// contain commas and cannot be joined like other repeated fields.
+	SetCookies []string
+
+	// Informational holds the 1xx responses, such as 103 Early Hints, that
+	// preceded the final response.
+	Informational []*Response
+
+	noBody     bool
+	untilClose bool
+	remaining  int
+	chunked    *chunked.Decoder
+}
+
+type Status struct {
+	HTTPVersion  string
+	StatusCode   StatusCode
+	ReasonPhrase string
+}
+
+type parseState string
+
+const (
+	StateInit        parseState = "init"
+	StateHeadersInit parseState = "parsing headers"
+	StateBodyInit    parseState = "parsing body"
+	StateDone        parseState = "done"
+)
+
+var crlf = []byte("\r\n")
+
+var ErrLineTooLong = errors.New("response line too long")
+
+func newResponse(requestMethod string) *Response {
+	return &Response{
+		State:    StateInit,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		noBody:   requestMethod == "HEAD",
+	}
+}
+
+func (r *Response) done() bool {
+	return r.State == StateDone
+}
+
+// ParseFromReader reads a complete response, including its body, from
+// reader.
+func ParseFromReader(reader io.Reader) (*Response, error) {
+	br, ok := reader.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(reader)
+	}
+
+	r, err := ReadHead(br, "")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(r.BodyReader(br))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+
+	return r, nil
+}
+
+// ReadHead reads the status line and headers from br and leaves the body
+// unread. requestMethod is the method of the request being answered and is
+// needed because responses to HEAD never have a body.
+func ReadHead(br *bufio.Reader, requestMethod string) (*Response, error) {
+	r := newResponse(requestMethod)
+	err := r.readUntil(br, func() bool {
+		return r.State == StateBodyInit || r.done()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// BodyReader returns a reader over the decoded body of a response returned by
+// ReadHead. Trailers are available once the reader returns io.EOF.
+func (r *Response) BodyReader(br *bufio.Reader) io.Reader {
+	return &bodyReader{r, br}
+}
+
+type bodyReader struct {
+	r  *Response
+	br *bufio.Reader
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	err := b.r.readUntil(b.br, func() bool {
+		return len(b.r.Body) > 0 || b.r.done()
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(b.r.Body) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.r.Body)
+	b.r.Body = b.r.Body[n:]
+	return n, nil
+}
+
+// readUntil feeds data from br to the parser until stop returns true. Only
+// parsed bytes are consumed from br, so a following response on the same
+// connection stays intact.
+func (r *Response) readUntil(br *bufio.Reader, stop func() bool) error {
+	want := 1
+	for !stop() {
+		var data []byte
+		var err error
+		if br.Buffered() >= want {
+			data, err = br.Peek(br.Buffered())
+		} else {
+			data, err = br.Peek(want)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return ErrLineTooLong
+		}
+		if err != nil && len(data) < want {
+			if err == io.EOF && r.State == StateBodyInit && r.untilClose {
+				// A body without a length is delimited by the server
+				// closing the connection.
+				r.State = StateDone
+				continue
+			}
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		n, err := r.parse(data)
+		if err != nil {
+			return fmt.Errorf("error while parsing response, %s", err)
+		}
+		br.Discard(n)
+
+		if n == 0 {
+			want = len(data) + 1
+		} else {
+			want = 1
+		}
+	}
+
+	return nil
+}
+
+func (r *Response) parse(data []byte) (int, error) {
+	if r.done() {
+		return 0, fmt.Errorf("trying to read data in done state")
+	}
+
+	parsedBytes := 0
+	for !r.done() {
+		n, err := r.parseSingle(data[parsedBytes:])
+		if err != nil {
+			return 0, err
+		}
+
+		if n == 0 {
+			break
+		}
+		parsedBytes += n
+	}
+
+	return parsedBytes, nil
+}
+
+func (r *Response) parseSingle(data []byte) (int, error) {
+	switch r.State {
+	case StateInit:
+		status, n, err := parseStatusLine(data)
+		if err != nil || n == 0 {
+			return 0, err
+		}
+
+		r.StatusLine = *status
+		r.State = StateHeadersInit
+		return n, nil
+
+	case StateHeadersInit:
+		n, done, err := r.Headers.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+		if v, ok := r.Headers["set-cookie"]; ok {
+			r.SetCookies = append(r.SetCookies, v)
+			delete(r.Headers, "set-cookie")
+		}
+
+		if done {
+			if r.informational() {
+				r.Informational = append(r.Informational, &Response{
+					StatusLine: r.StatusLine,
+					State:      StateDone,
+					Headers:    r.Headers,
+					SetCookies: r.SetCookies,
+				})
+				r.StatusLine = Status{}
+				r.Headers = headers.NewHeaders()
+				r.SetCookies = nil
+				r.State = StateInit
+				return n, nil
+			}
+
+			if err := r.startBody(); err != nil {
+				return 0, err
+			}
+		}
+		return n, nil
+
+	case StateBodyInit:
+		if len(data) == 0 {
+			return 0, nil
+		}
+
+		if r.chunked != nil {
+			n, done, err := r.chunked.Parse(data)
+			if err != nil {
+				return 0, err
+			}
+
+			r.Body = append(r.Body, r.chunked.Body...)
+			r.chunked.Body = r.chunked.Body[:0]
+			if done {
+				r.Trailers = r.chunked.Trailers
+				r.State = StateDone
+			}
+			return n, nil
+		}
+
+		if r.untilClose {
+			r.Body = append(r.Body, data...)
+			return len(data), nil
+		}
+
+		n := min(len(data), r.remaining)
+		r.Body = append(r.Body, data[:n]...)
+		r.remaining -= n
+		if r.remaining == 0 {
+			r.State = StateDone
+		}
+		return n, nil
+
+	default:
+		return 0, fmt.Errorf("unexpected state")
+	}
+}
+
+// informational reports whether the parsed head is an interim 1xx response
+// that is followed by another response. 101 Switching Protocols is final.
+func (r *Response) informational() bool {
+	code := r.StatusLine.StatusCode
+	return code/100 == 1 && code != 101
+}
+
+// startBody decides how the body is delimited once the headers are known.
+func (r *Response) startBody() error {
+	code := r.StatusLine.StatusCode
+	if r.noBody || code/100 == 1 || code == 204 || code == 304 {
+		r.State = StateDone
+		return nil
+	}
+
+	if te := r.Headers.Get("Transfer-Encoding"); te != "" {
+		codings := strings.Split(te, ",")
+		if strings.TrimSpace(strings.ToLower(codings[len(codings)-1])) == "chunked" {
+			r.chunked = chunked.NewDecoder()
+		} else {
+			r.untilClose = true
+		}
+		r.State = StateBodyInit
+		return nil
+	}
+
+	cl := r.Headers.Get("Content-Length")
+	if cl == "" {
+		r.untilClose = true
+		r.State = StateBodyInit
+		return nil
+	}
+
+	contentLength, err := strconv.Atoi(cl)
+	if err != nil || contentLength < 0 {
+		return fmt.Errorf("invalid content length: %s", cl)
+	}
+
+	r.remaining = contentLength
+	if contentLength == 0 {
+		r.State = StateDone
+	} else {
+		r.State = StateBodyInit
+	}
+	return nil
+}
+
+// KeepAlive reports whether the connection may be reused after this
+// response has been read completely.
+func (r *Response) KeepAlive() bool {
+	if r.untilClose {
+		return false
+	}
+	if strings.EqualFold(r.Headers.Get("Connection"), "close") {
+		return false
+	}
+	if r.StatusLine.HTTPVersion != "1.1" {
+		return strings.EqualFold(r.Headers.Get("Connection"), "keep-alive")
+	}
+	return true
+}
+
+func parseStatusLine(data []byte) (*Status, int, error) {
+	index := bytes.Index(data, crlf)
+	if index == -1 {
+		return nil, 0, nil
+	}
+
+	line := string(data[:index])
+	read := index + len(crlf)
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return nil, read, fmt.Errorf("too few parts in status line: %s", line)
+	}
+
+	version, ok := strings.CutPrefix(parts[0], "HTTP/")
+	if !ok || (version != "1.1" && version != "1.0") {
+		return nil, read, fmt.Errorf("unsupported http version: %s", parts[0])
+	}
+
+	if len(parts[1]) != 3 {
+		return nil, read, fmt.Errorf("invalid status code: %s", parts[1])
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil || code < 100 {
+		return nil, read, fmt.Errorf("invalid status code: %s", parts[1])
+	}
+
+	reason := ""
+	if len(parts) == 3 {
+		reason = parts[2]
+	}
+
+	return &Status{
+		HTTPVersion:  version,
+		StatusCode:   StatusCode(code),
+		ReasonPhrase: reason,
+	}, read, nil
+}
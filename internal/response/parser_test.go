@@ -0,0 +1,264 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/headers"
+)
+
+func TestStatusLineParse(t *testing.T) {
+	// Test: Good status line
+	r, err := ParseFromReader(&chunkReader{
+		data:            "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", r.StatusLine.HTTPVersion)
+	assert.Equal(t, StatusCode(404), r.StatusLine.StatusCode)
+	assert.Equal(t, "Not Found", r.StatusLine.ReasonPhrase)
+
+	// Test: Empty reason phrase
+	r, err = ParseFromReader(strings.NewReader("HTTP/1.1 299\r\nContent-Length: 0\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(299), r.StatusLine.StatusCode)
+	assert.Equal(t, "", r.StatusLine.ReasonPhrase)
+
+	// Test: Invalid version
+	_, err = ParseFromReader(strings.NewReader("HTTP/2 200 OK\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Invalid status code
+	_, err = ParseFromReader(strings.NewReader("HTTP/1.1 2000 OK\r\n\r\n"))
+	require.Error(t, err)
+
+	// Test: Truncated response
+	_, err = ParseFromReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nshort"))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestBodyFraming(t *testing.T) {
+	// Test: Content-Length body
+	r, err := ParseFromReader(&chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.True(t, r.KeepAlive())
+
+	// Test: Chunked body with trailers
+	r, err = ParseFromReader(&chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\nX-Sum: 1\r\n\r\n",
+		numBytesPerRead: 2,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.Equal(t, "1", r.Trailers.Get("X-Sum"))
+
+	// Test: Body delimited by connection close
+	r, err = ParseFromReader(&chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nConnection: close\r\n\r\nuntil the end",
+		numBytesPerRead: 4,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", string(r.Body))
+	assert.False(t, r.KeepAlive())
+
+	// Test: No body for 204 and 304
+	for _, code := range []int{204, 304} {
+		r, err = ParseFromReader(strings.NewReader(fmt.Sprintf("HTTP/1.1 %d X\r\n\r\nignored", code)))
+		require.NoError(t, err)
+		assert.Empty(t, r.Body)
+	}
+
+	// Test: No body for HEAD
+	br := bufio.NewReader(strings.NewReader("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n"))
+	r, err = ReadHead(br, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, StateDone, r.State)
+
+	// Test: Pipelined responses are read one at a time
+	br = bufio.NewReader(strings.NewReader(
+		"HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\none" +
+			"HTTP/1.1 201 Created\r\nTransfer-Encoding: chunked\r\n\r\n3\r\ntwo\r\n0\r\n\r\n"))
+	r, err = ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, "one", string(r.Body))
+	r, err = ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(201), r.StatusLine.StatusCode)
+	assert.Equal(t, "two", string(r.Body))
+}
+
+func TestInformationalResponses(t *testing.T) {
+	r, err := ParseFromReader(&chunkReader{
+		data: "HTTP/1.1 100 Continue\r\n\r\n" +
+			"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+		numBytesPerRead: 5,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(200), r.StatusLine.StatusCode)
+	assert.Equal(t, "ok", string(r.Body))
+	require.Len(t, r.Informational, 2)
+	assert.Equal(t, StatusCode(100), r.Informational[0].StatusLine.StatusCode)
+	assert.Equal(t, StatusCode(103), r.Informational[1].StatusLine.StatusCode)
+	assert.Equal(t, "</style.css>; rel=preload", r.Informational[1].Headers.Get("Link"))
+
+	// Test: 101 is a final response
+	r, err = ParseFromReader(strings.NewReader("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(101), r.StatusLine.StatusCode)
+	assert.Empty(t, r.Informational)
+}
+
+// message is a random response used to check that whatever Writer produces
+// is parsed back into the same response.
+type message struct {
+	Status       StatusCode
+	Headers      headers.Headers
+	Chunks       [][]byte
+	Chunked      bool
+	Trailers     headers.Headers
+	BytesPerRead int
+}
+
+func (message) Generate(rand *rand.Rand, size int) reflect.Value {
+	m := message{
+		Status:       StatusCode(200 + rand.Intn(400)),
+		Headers:      randomHeaders(rand, size),
+		Chunked:      rand.Intn(2) == 0,
+		Trailers:     headers.NewHeaders(),
+		BytesPerRead: 1 + rand.Intn(64),
+	}
+	// These codes never carry a body.
+	if m.Status == 204 || m.Status == 304 {
+		m.Status = 200
+	}
+
+	for i := rand.Intn(size + 1); i > 0; i-- {
+		chunk := make([]byte, rand.Intn(4*size+1))
+		rand.Read(chunk)
+		m.Chunks = append(m.Chunks, chunk)
+	}
+	if m.Chunked {
+		m.Trailers = randomHeaders(rand, size/4)
+	}
+
+	return reflect.ValueOf(m)
+}
+
+func (m message) body() []byte {
+	return bytes.Join(m.Chunks, nil)
+}
+
+func (m message) write(out io.Writer) {
+	w := &Writer{Writer: out, State: StatusLine}
+	w.WriteStatusLine(m.Status)
+
+	hdrs := headers.NewHeaders()
+	for k, v := range m.Headers {
+		hdrs[k] = v
+	}
+	if m.Chunked {
+		hdrs["transfer-encoding"] = "chunked"
+	} else {
+		hdrs["content-length"] = fmt.Sprint(len(m.body()))
+	}
+	w.WriteHeaders(hdrs)
+	w.Writer.Write([]byte("\r\n"))
+
+	if !m.Chunked {
+		w.WriteBody(m.body())
+		return
+	}
+	for _, chunk := range m.Chunks {
+		w.WriteChunkedBody(chunk)
+	}
+	w.WriteChunkedBodyDone()
+	w.WriteTrailers(m.Trailers)
+	// The server terminates every message with a final CRLF.
+	w.Writer.Write([]byte("\r\n"))
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	roundTrip := func(m message) bool {
+		out := &bytes.Buffer{}
+		m.write(out)
+
+		r, err := ParseFromReader(&chunkReader{data: out.String(), numBytesPerRead: m.BytesPerRead})
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+
+		for k, v := range m.Headers {
+			if r.Headers.Get(k) != v {
+				return false
+			}
+		}
+		for k, v := range m.Trailers {
+			if r.Trailers.Get(k) != v {
+				return false
+			}
+		}
+		return r.StatusLine.StatusCode == m.Status &&
+			r.StatusLine.ReasonPhrase == StatusText(m.Status) &&
+			bytes.Equal(r.Body, m.body())
+	}
+
+	require.NoError(t, quick.Check(roundTrip, &quick.Config{MaxCount: 500}))
+}
+
+const tokenChars = "abcdefghijklmnopqrstuvwxyz0123456789!#$%&'*+-.^_`|~"
+
+func randomHeaders(rand *rand.Rand, size int) headers.Headers {
+	h := headers.NewHeaders()
+	for i := rand.Intn(size + 1); i > 0; i-- {
+		key := "x-" + randomString(rand, tokenChars, 1+rand.Intn(16))
+		value := randomString(rand, tokenChars+" /:;=,", 1+rand.Intn(32))
+		h[key] = strings.Trim(value, " ") + "v"
+	}
+	return h
+}
+
+func randomString(rand *rand.Rand, alphabet string, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+// Read reads up to len(p) or numBytesPerRead bytes from the string per call
+// its useful for simulating reading a variable number of bytes per chunk from a network connection
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := cr.pos + cr.numBytesPerRead
+	if endIndex > len(cr.data) {
+		endIndex = len(cr.data)
+	}
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+
+	return n, nil
+}
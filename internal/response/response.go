@@ -4,19 +4,73 @@ package response
 import (
 	"fmt"
 	"io"
+	"maps"
+	"strings"
 
+	"httpFromTcp/internal/cookie"
 	"httpFromTcp/internal/headers"
 )
 
 type StatusCode int
 
 const (
-	Ok            StatusCode = 200
-	BadRequest    StatusCode = 400
-	InternalError StatusCode = 500
-	Unavailable   StatusCode = 503
+	Continue            StatusCode = 100
+	EarlyHints          StatusCode = 103
+	Ok                  StatusCode = 200
+	NoContent           StatusCode = 204
+	PartialContent      StatusCode = 206
+	MovedPermanently    StatusCode = 301
+	NotModified         StatusCode = 304
+	BadRequest          StatusCode = 400
+	Unauthorized        StatusCode = 401
+	Forbidden           StatusCode = 403
+	NotFound            StatusCode = 404
+	MethodNotAllowed    StatusCode = 405
+	ContentTooLarge     StatusCode = 413
+	UnsupportedMedia    StatusCode = 415
+	RangeNotSatisfiable StatusCode = 416
+	ExpectationFailed   StatusCode = 417
+	TooManyRequests     StatusCode = 429
+	HeadersTooLarge     StatusCode = 431
+	InternalError       StatusCode = 500
+	NotImplemented      StatusCode = 501
+	BadGateway          StatusCode = 502
+	Unavailable         StatusCode = 503
+	GatewayTimeout      StatusCode = 504
 )
 
+var statusText = map[StatusCode]string{
+	Continue:            "Continue",
+	EarlyHints:          "Early Hints",
+	Ok:                  "OK",
+	NoContent:           "No Content",
+	PartialContent:      "Partial Content",
+	MovedPermanently:    "Moved Permanently",
+	NotModified:         "Not Modified",
+	BadRequest:          "Bad Request",
+	Unauthorized:        "Unauthorized",
+	Forbidden:           "Forbidden",
+	NotFound:            "Not Found",
+	MethodNotAllowed:    "Method Not Allowed",
+	ContentTooLarge:     "Content Too Large",
+	UnsupportedMedia:    "Unsupported Media Type",
+	RangeNotSatisfiable: "Range Not Satisfiable",
+	ExpectationFailed:   "Expectation Failed",
+	TooManyRequests:     "Too Many Requests",
+	HeadersTooLarge:     "Request Header Fields Too Large",
+	InternalError:       "Internal Server Error",
+	NotImplemented:      "Not Implemented",
+	BadGateway:          "Bad Gateway",
+	Unavailable:         "Service Temporarily Unavailable",
+	GatewayTimeout:      "Gateway Timeout",
+}
+
+// StatusText returns the reason phrase for code, or an empty string if the
+// code is unknown.
+func StatusText(code StatusCode) string {
+	return statusText[code]
+}
+
 type WriterStatus string
 
 const (
@@ -28,6 +82,25 @@ const (
 type Writer struct {
 	Writer io.Writer
 	State  WriterStatus
+
+	status      StatusCode
+	headerHooks []func(StatusCode, headers.Headers)
+	cookies     []string
+	encoder     io.WriteCloser
+	finished    bool
+	written     int64
+}
+
+// Status returns the status code of the final response, or 0 if the status
+// line has not been written.
+func (w *Writer) Status() StatusCode {
+	return w.status
+}
+
+// BytesWritten returns the number of body bytes sent so far, counted after
+// any transformation such as compression and without chunk framing.
+func (w *Writer) BytesWritten() int64 {
+	return w.written
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
@@ -35,64 +108,165 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 		return fmt.Errorf("trying to write status line when writer status is: %s", w.State)
 	}
 
-	switch statusCode {
-	case Ok:
-		_, err := w.Writer.Write([]byte("HTTP/1.1 200 OK\r\n"))
-		if err != nil {
-			return err
-		}
-	case BadRequest:
-		_, err := w.Writer.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
-		if err != nil {
-			return err
-		}
-	case InternalError:
-		_, err := w.Writer.Write([]byte("HTTP/1.1 500 Internal Server Error\r\n"))
-		if err != nil {
-			return err
-		}
-
-	case Unavailable:
-		_, err := w.Writer.Write([]byte("HTTP/1.1 503 Service Temporarily Unavailable\r\n"))
-		if err != nil {
-			return err
-		}
+	_, err := fmt.Fprintf(w.Writer, "HTTP/1.1 %d %s\r\n", statusCode, StatusText(statusCode))
+	if err != nil {
+		return err
 	}
 
+	w.status = statusCode
 	w.State = Headers
 	return nil
 }
 
+// WriteInformational sends an interim 1xx response, such as 103 Early Hints,
+// ahead of the final one. The writer stays ready for the final status line.
+func (w *Writer) WriteInformational(statusCode StatusCode, h headers.Headers) error {
+	if w.State != StatusLine {
+		return fmt.Errorf("trying to write informational response when writer status is: %s", w.State)
+	}
+	if statusCode/100 != 1 || statusCode == 101 {
+		return fmt.Errorf("not an informational status code: %d", statusCode)
+	}
+
+	_, err := fmt.Fprintf(w.Writer, "HTTP/1.1 %d %s\r\n", statusCode, StatusText(statusCode))
+	if err != nil {
+		return err
+	}
+	for k, v := range h {
+		if _, err := fmt.Fprintf(w.Writer, "%s: %s\r\n", k, v); err != nil {
+			return err
+		}
+	}
+	_, err = w.Writer.Write([]byte("\r\n"))
+	return err
+}
+
 func (w *Writer) WriteHeaders(headers headers.Headers) error {
 	if w.State != Headers {
 		return fmt.Errorf("trying to write headers when writer status is: %s", w.State)
 	}
 
+	if len(w.headerHooks) > 0 {
+		headers = maps.Clone(headers)
+		for _, hook := range w.headerHooks {
+			hook(w.status, headers)
+		}
+	}
+
 	for k, v := range headers {
 		_, err := fmt.Fprintf(w.Writer, "%s: %s\r\n", k, v)
 		if err != nil {
 			return err
 		}
 	}
+	// Set-Cookie cannot be folded into one line, so the cookies are kept
+	// apart from the headers map.
+	for _, c := range w.cookies {
+		_, err := fmt.Fprintf(w.Writer, "Set-Cookie: %s\r\n", c)
+		if err != nil {
+			return err
+		}
+	}
 
 	w.State = Body
 	return nil
 }
 
+// SetCookie adds a Set-Cookie header. It must be called before WriteHeaders
+// or from an OnHeaders hook.
+func (w *Writer) SetCookie(c *cookie.Cookie) error {
+	if w.State == Body {
+		return fmt.Errorf("trying to set cookie when writer status is: %s", w.State)
+	}
+
+	line, err := c.String()
+	if err != nil {
+		return err
+	}
+	w.cookies = append(w.cookies, line)
+	return nil
+}
+
+// AddSetCookie adds a Set-Cookie header with an already formatted value,
+// such as one received from an upstream server.
+func (w *Writer) AddSetCookie(value string) error {
+	if w.State == Body {
+		return fmt.Errorf("trying to set cookie when writer status is: %s", w.State)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("invalid Set-Cookie value: %q", value)
+	}
+
+	w.cookies = append(w.cookies, value)
+	return nil
+}
+
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.State != Body {
 		return 0, fmt.Errorf("trying to write body when writer status is: %s", w.State)
 	}
 
-	return w.Writer.Write(p)
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	n, err := w.Writer.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// ReadFrom copies the body from r. If the underlying writer implements
+// io.ReaderFrom, as *net.TCPConn does, and the body is not transformed, the
+// copy is delegated to it so that files are sent with sendfile or splice on
+// Linux without passing through user space.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if w.State != Body {
+		return 0, fmt.Errorf("trying to write body when writer status is: %s", w.State)
+	}
+
+	if w.encoder != nil {
+		return io.Copy(writerOnly{w.encoder}, r)
+	}
+	var n int64
+	var err error
+	if rf, ok := w.Writer.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{w.Writer}, r)
+	}
+	w.written += n
+	return n, err
+}
+
+// writerOnly hides any ReadFrom method of the wrapped writer so io.Copy
+// takes the buffered path.
+type writerOnly struct {
+	io.Writer
 }
 
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	// An empty chunk would be read as the last chunk.
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if w.encoder != nil {
+		return w.writeEncodedChunk(p)
+	}
+
 	hexSize := fmt.Sprintf("%x", len(p))
-	return fmt.Fprintf(w.Writer, "%s\r\n%s\r\n", hexSize, p)
+	if _, err := fmt.Fprintf(w.Writer, "%s\r\n%s\r\n", hexSize, p); err != nil {
+		return 0, err
+	}
+	w.written += int64(len(p))
+	return len(p), nil
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if err := w.closeEncoder(); err != nil {
+		return 0, err
+	}
+
+	w.finished = true
 	return w.Writer.Write([]byte("0\r\n"))
 }
 
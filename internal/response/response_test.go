@@ -0,0 +1,203 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/cookie"
+)
+
+func TestWriterReadFrom(t *testing.T) {
+	// Test: Body before headers
+	w := &Writer{Writer: &bytes.Buffer{}, State: StatusLine}
+	_, err := w.ReadFrom(strings.NewReader("body"))
+	require.Error(t, err)
+
+	// Test: Underlying writer with ReadFrom
+	out := &bytes.Buffer{}
+	w = &Writer{Writer: out, State: Body}
+	n, err := w.ReadFrom(strings.NewReader("body"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	assert.Equal(t, "body", out.String())
+
+	// Test: File over a TCP connection
+	path := writeTempFile(t, 1<<20)
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	conn, received := tcpPair(t)
+	w = &Writer{Writer: conn, State: Body}
+	n, err = w.ReadFrom(f)
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, int64(1<<20), n)
+	assert.Equal(t, int64(1<<20), <-received)
+}
+
+func TestWriterCounts(t *testing.T) {
+	// Test: Plain body
+	w := &Writer{Writer: &bytes.Buffer{}, State: StatusLine}
+	assert.Equal(t, StatusCode(0), w.Status())
+	require.NoError(t, w.WriteStatusLine(NotFound))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(9, "text/plain", false)))
+	w.WriteBody([]byte("not "))
+	w.ReadFrom(strings.NewReader("found"))
+	assert.Equal(t, NotFound, w.Status())
+	assert.Equal(t, int64(9), w.BytesWritten())
+
+	// Test: Chunk framing is not counted
+	w = &Writer{Writer: &bytes.Buffer{}, State: StatusLine}
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0, "text/plain", true)))
+	w.WriteChunkedBody([]byte("hello"))
+	w.WriteChunkedBodyDone()
+	assert.Equal(t, int64(5), w.BytesWritten())
+
+	// Test: Transformed bodies count the bytes sent
+	w = &Writer{Writer: &bytes.Buffer{}, State: StatusLine}
+	require.NoError(t, w.TransformBody(func(dst io.Writer) io.WriteCloser { return halver{dst} }))
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0, "text/plain", true)))
+	w.WriteBody([]byte("hello world!"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, int64(6), w.BytesWritten())
+}
+
+// halver passes on every other byte.
+type halver struct{ w io.Writer }
+
+func (h halver) Write(p []byte) (int, error) {
+	half := make([]byte, 0, len(p)/2)
+	for i := 1; i < len(p); i += 2 {
+		half = append(half, p[i])
+	}
+	_, err := h.w.Write(half)
+	return len(p), err
+}
+
+func (h halver) Close() error { return nil }
+
+func TestWriterSetCookie(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := &Writer{Writer: out, State: StatusLine}
+
+	// Test: Several cookies get their own lines
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "a", Value: "1", HttpOnly: true}))
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "b", Value: "2", Expires: time.Unix(0, 0)}))
+	require.Error(t, w.SetCookie(&cookie.Cookie{Name: "bad name"}))
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0, "text/plain", false)))
+	assert.Contains(t, out.String(), "Set-Cookie: a=1; HttpOnly\r\n")
+	assert.Contains(t, out.String(), "Set-Cookie: b=2; Expires=Thu, 01 Jan 1970 00:00:00 GMT\r\n")
+
+	// Test: Too late once the headers are out
+	require.Error(t, w.SetCookie(&cookie.Cookie{Name: "c", Value: "3"}))
+	require.Error(t, w.AddSetCookie("c=3"))
+
+	// Test: Cookies received from elsewhere round trip through the parser
+	out = &bytes.Buffer{}
+	w = &Writer{Writer: out, State: StatusLine}
+	require.NoError(t, w.AddSetCookie("a=1; Expires=Thu, 01 Jan 1970 00:00:00 GMT"))
+	require.NoError(t, w.AddSetCookie("b=2"))
+	require.Error(t, w.AddSetCookie("c=3\r\nX-Injected: 1"))
+	require.NoError(t, w.WriteStatusLine(Ok))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0, "text/plain", false)))
+	w.Writer.Write([]byte("\r\n"))
+	r, err := ParseFromReader(out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1; Expires=Thu, 01 Jan 1970 00:00:00 GMT", "b=2"}, r.SetCookies)
+	assert.Empty(t, r.Headers.Get("Set-Cookie"))
+}
+
+const benchFileSize = 16 << 20
+
+// BenchmarkWriteBody copies a file to a TCP connection through a user space
+// buffer, the way handlers did before ReadFrom existed.
+func BenchmarkWriteBody(b *testing.B) {
+	path := writeTempFile(b, benchFileSize)
+	conn, _ := tcpPair(b)
+	buf := make([]byte, 32*1024)
+
+	b.SetBytes(benchFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		require.NoError(b, err)
+		w := &Writer{Writer: conn, State: Body}
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				if _, err := w.WriteBody(buf[:n]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			require.NoError(b, err)
+		}
+		f.Close()
+	}
+}
+
+// BenchmarkReadFrom copies the same file with ReadFrom, which uses sendfile
+// on Linux.
+func BenchmarkReadFrom(b *testing.B) {
+	path := writeTempFile(b, benchFileSize)
+	conn, _ := tcpPair(b)
+
+	b.SetBytes(benchFileSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(path)
+		require.NoError(b, err)
+		w := &Writer{Writer: conn, State: Body}
+		if _, err := w.ReadFrom(f); err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+	}
+}
+
+func writeTempFile(tb testing.TB, size int) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "body")
+	require.NoError(tb, os.WriteFile(path, bytes.Repeat([]byte("x"), size), 0o644))
+	return path
+}
+
+// tcpPair returns the sending side of a loopback TCP connection. The other
+// side discards everything and reports the byte count once closed.
+func tcpPair(tb testing.TB) (net.Conn, <-chan int64) {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	defer ln.Close()
+
+	received := make(chan int64, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n, _ := io.Copy(io.Discard, conn)
+		received <- n
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(tb, err)
+	tb.Cleanup(func() { conn.Close() })
+	return conn, received
+}
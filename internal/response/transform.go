@@ -0,0 +1,88 @@
+package response
+
+import (
+	"fmt"
+	"io"
+
+	"httpFromTcp/internal/headers"
+)
+
+// OnHeaders registers fn to run right before the headers are written. fn
+// receives the status code and may modify the headers. Middleware uses it to
+// decorate responses without the handler's cooperation.
+func (w *Writer) OnHeaders(fn func(status StatusCode, h headers.Headers)) {
+	w.headerHooks = append(w.headerHooks, fn)
+}
+
+// TransformBody routes the body through the writer returned by fn, for
+// example a compressor. The transformed body is sent with the chunked
+// transfer coding, so it must be called from an OnHeaders hook that also sets
+// Transfer-Encoding: chunked and removes Content-Length.
+func (w *Writer) TransformBody(fn func(io.Writer) io.WriteCloser) error {
+	if w.State == Body {
+		return fmt.Errorf("trying to transform body when writer status is: %s", w.State)
+	}
+	if w.encoder != nil {
+		return fmt.Errorf("body is already transformed")
+	}
+
+	w.encoder = fn(chunkWriter{w.Writer, &w.written})
+	return nil
+}
+
+// Finish terminates a transformed body that the handler wrote with
+// WriteBody. It does nothing if the body is not transformed or was already
+// terminated with WriteChunkedBodyDone.
+func (w *Writer) Finish() error {
+	if w.encoder == nil || w.finished {
+		return nil
+	}
+
+	w.finished = true
+	if err := w.closeEncoder(); err != nil {
+		return err
+	}
+	_, err := w.Writer.Write([]byte("0\r\n"))
+	return err
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// writeEncodedChunk feeds a chunk the handler meant to stream into the
+// encoder and flushes it so streaming still reaches the client promptly.
+func (w *Writer) writeEncodedChunk(p []byte) (int, error) {
+	n, err := w.encoder.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if f, ok := w.encoder.(flusher); ok {
+		return n, f.Flush()
+	}
+	return n, nil
+}
+
+func (w *Writer) closeEncoder() error {
+	if w.encoder == nil {
+		return nil
+	}
+	return w.encoder.Close()
+}
+
+// chunkWriter frames every write as one chunk and counts the bytes framed.
+type chunkWriter struct {
+	w       io.Writer
+	written *int64
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(cw.w, "%x\r\n%s\r\n", len(p), p); err != nil {
+		return 0, err
+	}
+	*cw.written += int64(len(p))
+	return len(p), nil
+}
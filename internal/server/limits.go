@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"httpFromTcp/internal/response"
+)
+
+// OverloadPolicy decides what happens to connections over the limits.
+type OverloadPolicy int
+
+const (
+	// StopAccepting leaves new connections in the kernel's accept queue
+	// until a slot frees up. Connections over the per-IP cap are closed.
+	StopAccepting OverloadPolicy = iota
+	// RejectUnavailable accepts connections over the limits and answers
+	// them right away with 503 and Retry-After.
+	RejectUnavailable
+)
+
+const (
+	defaultRetryAfter = 5 * time.Second
+	rejectTimeout     = time.Second
+)
+
+// WithMaxConnections limits the number of connections served at once.
+func WithMaxConnections(n int) Option {
+	return func(s *Server) {
+		s.maxConns = n
+	}
+}
+
+// WithMaxConnectionsPerIP limits the number of connections served at once
+// for a single client IP.
+func WithMaxConnectionsPerIP(n int) Option {
+	return func(s *Server) {
+		s.maxConnsPerIP = n
+	}
+}
+
+// WithOverloadPolicy sets what happens to connections over the limits.
+// retryAfter is sent with RejectUnavailable and ignored otherwise. The
+// default is StopAccepting.
+func WithOverloadPolicy(policy OverloadPolicy, retryAfter time.Duration) Option {
+	return func(s *Server) {
+		s.overload = policy
+		s.retryAfter = retryAfter
+	}
+}
+
+// ConnStats counts the server's connections.
+type ConnStats struct {
+	// Open is the number of connections being served.
+	Open int64
+	// Accepted counts connections admitted since the server started.
+	Accepted uint64
+	// RejectedMax counts connections turned away by WithMaxConnections.
+	RejectedMax uint64
+	// RejectedPerIP counts connections turned away by
+	// WithMaxConnectionsPerIP.
+	RejectedPerIP uint64
+	// RejectedQueue counts connections turned away because the worker
+	// pool's queue was full.
+	RejectedQueue uint64
+}
+
+type connLimits struct {
+	slots chan struct{}
+
+	mu    sync.Mutex
+	perIP map[string]int
+
+	open          atomic.Int64
+	accepted      atomic.Uint64
+	rejectedMax   atomic.Uint64
+	rejectedPerIP atomic.Uint64
+	rejectedQueue atomic.Uint64
+}
+
+// ConnStats returns the current connection counts.
+func (s *Server) ConnStats() ConnStats {
+	return ConnStats{
+		Open:          s.limits.open.Load(),
+		Accepted:      s.limits.accepted.Load(),
+		RejectedMax:   s.limits.rejectedMax.Load(),
+		RejectedPerIP: s.limits.rejectedPerIP.Load(),
+		RejectedQueue: s.limits.rejectedQueue.Load(),
+	}
+}
+
+func (s *Server) initLimits() {
+	if s.maxConns > 0 {
+		s.limits.slots = make(chan struct{}, s.maxConns)
+	}
+	s.limits.perIP = map[string]int{}
+	if s.retryAfter <= 0 {
+		s.retryAfter = defaultRetryAfter
+	}
+}
+
+// waitForSlot blocks until a connection slot is free under StopAccepting.
+// It returns false once the server is closed.
+func (s *Server) waitForSlot() bool {
+	if s.limits.slots == nil || s.overload != StopAccepting {
+		return true
+	}
+
+	select {
+	case s.limits.slots <- struct{}{}:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// admit checks conn against the limits. reserved tells whether a slot was
+// already taken by waitForSlot. On success the returned func releases what
+// the connection holds.
+func (s *Server) admit(conn net.Conn, reserved bool) (func(), bool) {
+	l := &s.limits
+
+	if l.slots != nil && !reserved {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			l.rejectedMax.Add(1)
+			s.reject(conn)
+			return nil, false
+		}
+	}
+	releaseSlot := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	ip := remoteIP(conn)
+	if s.maxConnsPerIP > 0 {
+		l.mu.Lock()
+		if l.perIP[ip] >= s.maxConnsPerIP {
+			l.mu.Unlock()
+			releaseSlot()
+			l.rejectedPerIP.Add(1)
+			s.reject(conn)
+			return nil, false
+		}
+		l.perIP[ip]++
+		l.mu.Unlock()
+	}
+
+	l.accepted.Add(1)
+	l.open.Add(1)
+
+	return func() {
+		l.open.Add(-1)
+		if s.maxConnsPerIP > 0 {
+			l.mu.Lock()
+			if l.perIP[ip]--; l.perIP[ip] == 0 {
+				delete(l.perIP, ip)
+			}
+			l.mu.Unlock()
+		}
+		releaseSlot()
+	}, true
+}
+
+// reject turns away a connection over the limits.
+func (s *Server) reject(conn net.Conn) {
+	if s.overload != RejectUnavailable {
+		conn.Close()
+		return
+	}
+
+	// The client may be slow or, on TLS, still handshaking, so do not hold
+	// up the accept loop.
+	go func() {
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(rejectTimeout))
+
+		status := response.Unavailable
+		body := fmt.Sprintf("%d %s\n", status, response.StatusText(status))
+		h := response.GetDefaultHeaders(len(body), "text/plain", false)
+		h["Retry-After"] = fmt.Sprint(int(math.Ceil(s.retryAfter.Seconds())))
+
+		w := &response.Writer{Writer: conn, State: response.StatusLine}
+		w.WriteStatusLine(status)
+		w.WriteHeaders(h)
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody([]byte(body))
+	}()
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
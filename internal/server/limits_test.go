@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+// blocking returns a handler that holds every connection until release is
+// closed.
+func blocking() (Handler, chan struct{}) {
+	release := make(chan struct{})
+	return func(w *response.Writer, req *request.Request) {
+		<-release
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(2, "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody([]byte("ok"))
+	}, release
+}
+
+func waitOpen(t *testing.T, srv *Server, n int64) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return srv.ConnStats().Open == n
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestMaxConnectionsReject(t *testing.T) {
+	handler, release := blocking()
+	defer close(release)
+	srv := serve(t, handler,
+		WithMaxConnections(2),
+		WithOverloadPolicy(RejectUnavailable, 3*time.Second),
+	)
+
+	for range 2 {
+		conn, _ := dial(t, srv)
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+	}
+	waitOpen(t, srv, 2)
+
+	// Test: Connections over the limit get 503
+	conn, br := dial(t, srv)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+	r, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Unavailable, r.StatusLine.StatusCode)
+	assert.Equal(t, "3", r.Headers.Get("Retry-After"))
+
+	stats := srv.ConnStats()
+	assert.Equal(t, uint64(2), stats.Accepted)
+	assert.Equal(t, uint64(1), stats.RejectedMax)
+	assert.Equal(t, uint64(0), stats.RejectedPerIP)
+}
+
+func TestMaxConnectionsPerIP(t *testing.T) {
+	handler, release := blocking()
+	srv := serve(t, handler,
+		WithMaxConnectionsPerIP(1),
+		WithOverloadPolicy(RejectUnavailable, 0),
+	)
+
+	first, firstBr := dial(t, srv)
+	fmt.Fprint(first, "GET / HTTP/1.1\r\n\r\n")
+	waitOpen(t, srv, 1)
+
+	// Test: Second connection from the same IP is rejected
+	_, br := dial(t, srv)
+	r, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Unavailable, r.StatusLine.StatusCode)
+	assert.Equal(t, "5", r.Headers.Get("Retry-After"))
+	assert.Equal(t, uint64(1), srv.ConnStats().RejectedPerIP)
+
+	// Test: The IP's slot is released when the connection ends
+	close(release)
+	r, err = response.ParseFromReader(firstBr)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	waitOpen(t, srv, 0)
+
+	conn, br := dial(t, srv)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+	r, err = response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+}
+
+func TestMaxConnectionsStopAccepting(t *testing.T) {
+	handler, release := blocking()
+	srv := serve(t, handler, WithMaxConnections(1))
+
+	first, _ := dial(t, srv)
+	fmt.Fprint(first, "GET / HTTP/1.1\r\n\r\n")
+	waitOpen(t, srv, 1)
+
+	// Test: The next connection waits in the accept queue
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+	assert.Equal(t, uint64(1), srv.ConnStats().Accepted)
+
+	// Test: It is served once a slot frees up
+	close(release)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	r, err := response.ParseFromReader(conn)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, uint64(0), srv.ConnStats().RejectedMax)
+}
+
+func TestCloseWhileWaitingForSlot(t *testing.T) {
+	handler, release := blocking()
+	defer close(release)
+	srv, err := Serve(0, handler, WithMaxConnections(1))
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+	waitOpen(t, srv, 1)
+
+	// Test: Close does not hang or panic with the accept loop parked
+	require.NoError(t, srv.Close())
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	handler, release := blocking()
+	close(release)
+	srv := serve(t, handler, WithMaxConnections(1), WithReadHeaderTimeout(50*time.Millisecond))
+
+	// Test: An idle client is dropped and frees its slot
+	idle, idleBr := dial(t, srv)
+	fmt.Fprint(idle, "GET / HTTP/1.1\r\nHost: x")
+	waitOpen(t, srv, 1)
+
+	conn, br := dial(t, srv)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+	r, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+
+	_, err = idleBr.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: The deadline is lifted once the head is read
+	slow := serve(t, func(w *response.Writer, req *request.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(0, "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+	}, WithReadHeaderTimeout(50*time.Millisecond))
+	conn, br = dial(t, slow)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+	r, err = response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net"
+	"sync"
+)
+
+const maxPooledBuffer = 64 << 10
+
+// WithWorkerPool serves connections from a fixed set of worker goroutines
+// instead of one new goroutine per connection. Up to queue accepted
+// connections wait for a free worker. When the queue is full the accept
+// loop waits, or with RejectUnavailable the connection gets 503.
+func WithWorkerPool(workers, queue int) Option {
+	return func(s *Server) {
+		s.workers = workers
+		s.queueSize = queue
+	}
+}
+
+// WithBufferPool parses requests into buffers of size bytes taken from a
+// pool, instead of a small buffer grown for every request. Buffers are
+// returned to the pool when their connection ends.
+func WithBufferPool(size int) Option {
+	return func(s *Server) {
+		s.buffers = &sync.Pool{
+			New: func() any {
+				buf := make([]byte, size)
+				return &buf
+			},
+		}
+	}
+}
+
+type connJob struct {
+	conn    net.Conn
+	release func()
+}
+
+func (s *Server) startWorkers() {
+	if s.workers <= 0 {
+		return
+	}
+	s.queue = make(chan connJob, max(s.queueSize, 0))
+	for range s.workers {
+		go s.worker()
+	}
+}
+
+func (s *Server) worker() {
+	for {
+		select {
+		case job := <-s.queue:
+			s.serveConn(job)
+		case <-s.done:
+			s.drainQueue()
+			return
+		}
+	}
+}
+
+// drainQueue closes connections that were still waiting when the server
+// was closed.
+func (s *Server) drainQueue() {
+	for {
+		select {
+		case job := <-s.queue:
+			job.conn.Close()
+			job.release()
+		default:
+			return
+		}
+	}
+}
+
+// dispatch hands an admitted connection to a worker, or to a new goroutine
+// without a worker pool.
+func (s *Server) dispatch(job connJob) {
+	if s.queue == nil {
+		go s.serveConn(job)
+		return
+	}
+
+	if s.overload == RejectUnavailable {
+		select {
+		case s.queue <- job:
+		default:
+			job.release()
+			s.limits.rejectedQueue.Add(1)
+			s.reject(job.conn)
+		}
+		return
+	}
+
+	select {
+	case s.queue <- job:
+	case <-s.done:
+		job.conn.Close()
+		job.release()
+	}
+}
+
+func (s *Server) serveConn(job connJob) {
+	defer job.release()
+	s.handle(job.conn)
+}
+
+func (s *Server) getBuffer() *[]byte {
+	if s.buffers == nil {
+		return nil
+	}
+	return s.buffers.Get().(*[]byte)
+}
+
+func (s *Server) putBuffer(bufp *[]byte, buf []byte) {
+	if bufp == nil || cap(buf) > maxPooledBuffer {
+		return
+	}
+	*bufp = buf[:cap(buf)]
+	s.buffers.Put(bufp)
+}
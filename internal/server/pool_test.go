@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+var echo Handler = func(w *response.Writer, req *request.Request) {
+	body := req.Body
+	if len(body) == 0 {
+		body = []byte(req.Headers.Get("X-Echo"))
+	}
+	w.WriteStatusLine(response.Ok)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+	w.Writer.Write([]byte("\r\n"))
+	w.WriteBody(body)
+}
+
+func TestWorkerPool(t *testing.T) {
+	handler, release := blocking()
+	srv := serve(t, handler,
+		WithWorkerPool(2, 1),
+		WithOverloadPolicy(RejectUnavailable, time.Second),
+	)
+
+	var readers []*bufio.Reader
+	for range 3 {
+		conn, br := dial(t, srv)
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+		readers = append(readers, br)
+	}
+	// Two connections are with workers and one waits in the queue.
+	waitOpen(t, srv, 3)
+
+	// Test: Full queue rejects
+	_, br := dial(t, srv)
+	r, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Unavailable, r.StatusLine.StatusCode)
+	assert.Equal(t, uint64(1), srv.ConnStats().RejectedQueue)
+
+	// Test: Queued connection is served once a worker frees up
+	close(release)
+	for _, br := range readers {
+		r, err := response.ParseFromReader(br)
+		require.NoError(t, err)
+		assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	}
+	waitOpen(t, srv, 0)
+}
+
+func TestBufferPool(t *testing.T) {
+	srv := serve(t, echo, WithBufferPool(64), WithWorkerPool(1, 4))
+
+	// Reusing one buffer across requests of varying size must not leak
+	// bytes from one request into the next.
+	for i, body := range []string{
+		"first body",
+		"",
+		strings.Repeat("b", 500),
+		"x",
+	} {
+		conn, br := dial(t, srv)
+		echoHeader := strings.Repeat(fmt.Sprint(i), 100)
+		fmt.Fprintf(conn, "POST / HTTP/1.1\r\nX-Echo: %s\r\nContent-Length: %d\r\n\r\n%s", echoHeader, len(body), body)
+
+		r, err := response.ParseFromReader(br)
+		require.NoError(t, err)
+		want := body
+		if want == "" {
+			want = echoHeader
+		}
+		assert.Equal(t, want, string(r.Body), i)
+	}
+}
+
+func TestBufferPoolMalformed(t *testing.T) {
+	var allocs atomic.Int32
+	countAllocs := func(s *Server) {
+		newBuffer := s.buffers.New
+		s.buffers.New = func() any {
+			allocs.Add(1)
+			return newBuffer()
+		}
+	}
+	srv := serve(t, echo, WithBufferPool(64), countAllocs, WithWorkerPool(1, 4))
+
+	// Requests that fail to parse must hand their buffer back. sync.Pool
+	// may still drop some (it does so deliberately under -race), so only
+	// check that most were reused.
+	const n = 40
+	for range n {
+		conn, br := dial(t, srv)
+		fmt.Fprint(conn, "GET / HTTP/1.1\r\nno colon\r\n\r\n")
+
+		r, err := response.ParseFromReader(br)
+		require.NoError(t, err)
+		assert.Equal(t, response.BadRequest, r.StatusLine.StatusCode)
+	}
+	assert.Less(t, allocs.Load(), int32(n/2))
+}
+
+func benchmarkServe(b *testing.B, opts ...Option) {
+	srv, err := Serve(0, echo, opts...)
+	require.NoError(b, err)
+	defer srv.Close()
+
+	raw := "GET / HTTP/1.1\r\nHost: localhost\r\nUser-Agent: bench/1.0\r\nAccept: */*\r\nX-Echo: hello\r\n\r\n"
+	addr := srv.Addr().String()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		buf := make([]byte, 4096)
+		for pb.Next() {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			conn.Write([]byte(raw))
+			for {
+				if _, err := conn.Read(buf); err != nil {
+					break
+				}
+			}
+			conn.Close()
+		}
+	})
+}
+
+// The allocation counts include the benchmark's own dialing, which is the
+// same for every variant.
+func BenchmarkServe(b *testing.B) {
+	b.Run("goroutine-per-conn", func(b *testing.B) {
+		benchmarkServe(b)
+	})
+	b.Run("buffer-pool", func(b *testing.B) {
+		benchmarkServe(b, WithBufferPool(4096))
+	})
+	b.Run("worker-pool", func(b *testing.B) {
+		benchmarkServe(b, WithWorkerPool(16, 256))
+	})
+	b.Run("worker-and-buffer-pool", func(b *testing.B) {
+		benchmarkServe(b, WithWorkerPool(16, 256), WithBufferPool(4096))
+	})
+}
@@ -2,9 +2,18 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"httpFromTcp/internal/request"
 	"httpFromTcp/internal/response"
@@ -17,50 +26,195 @@ type HandlerError struct {
 
 type Handler func(w *response.Writer, req *request.Request)
 
+// Middleware wraps a Handler with additional behaviour.
+type Middleware func(Handler) Handler
+
+// Chain wraps h with middlewares. The first middleware is the outermost, so
+// it sees the request first.
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
 type Server struct {
 	listener      net.Listener
 	serverRunning atomic.Bool
 	handler       Handler
+
+	tlsConfig  *tls.Config
+	clientCAs  *x509.CertPool
+	clientAuth ClientAuthMode
+
+	maxBodySize       int64
+	readHeaderTimeout time.Duration
+
+	parseErrorHook func(error)
+	logger         *slog.Logger
+
+	maxConns      int
+	maxConnsPerIP int
+	overload      OverloadPolicy
+	retryAfter    time.Duration
+	limits        connLimits
+	done          chan struct{}
+
+	workers   int
+	queueSize int
+	queue     chan connJob
+	buffers   *sync.Pool
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+// Option configures a Server before it starts accepting connections.
+type Option func(*Server)
+
+// WithMaxBodySize rejects requests announcing a body larger than n bytes
+// with 413 before any of the body is read.
+func WithMaxBodySize(n int64) Option {
+	return func(s *Server) {
+		s.maxBodySize = n
+	}
+}
+
+// WithReadHeaderTimeout bounds the time a client has to finish the TLS
+// handshake and send the request line and headers. Without it an idle
+// connection would hold its goroutine, and its slot under
+// WithMaxConnections, forever. The default is 10 seconds; 0 or less
+// disables the limit.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readHeaderTimeout = d
+	}
+}
+
+// WithParseErrorHook calls fn with every error reading or parsing a
+// request, such as a malformed head or a body over the size limit. A client
+// closing the connection without sending anything is not reported.
+func WithParseErrorHook(fn func(err error)) Option {
+	return func(s *Server) {
+		s.parseErrorHook = fn
+	}
+}
+
+// WithLogger sets where the server logs accept errors, handler panics,
+// shutdown and, at debug level, requests it could not parse. The default is
+// slog.Default().
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+const defaultReadHeaderTimeout = 10 * time.Second
+
+// Accept errors are retried after a delay doubling from minAcceptDelay up
+// to maxAcceptDelay, so running out of file descriptors does not spin.
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
+	server := &Server{
+		handler:           handler,
+		done:              make(chan struct{}),
+		logger:            slog.Default(),
+		readHeaderTimeout: defaultReadHeaderTimeout,
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	server.initLimits()
+
+	tlsConfig, err := server.buildTLSConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	server := &Server{
-		ln,
-		atomic.Bool{},
-		handler,
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
 	}
-	server.listen()
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	server.listener = ln
+	server.serverRunning.Store(true)
+	server.startWorkers()
+	go server.listen()
+	server.logger.Info("server listening", "addr", ln.Addr().String())
 
 	return server, nil
 }
 
 func (he *HandlerError) writeError(w *response.Writer) error {
 	err := w.WriteStatusLine(response.StatusCode(he.Status))
+	if err != nil {
+		return err
+	}
+
+	body := he.Message + "\n"
+	err = w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+	if err != nil {
+		return err
+	}
+	w.Writer.Write([]byte("\r\n"))
+	_, err = w.WriteBody([]byte(body))
 	return err
 }
 
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
 func (s *Server) Close() error {
-	s.serverRunning.Store(false)
+	if s.serverRunning.Swap(false) {
+		s.logger.Info("server shutting down", "addr", s.listener.Addr().String(), "open_connections", s.limits.open.Load())
+		close(s.done)
+	}
 	return s.listener.Close()
 }
 
 func (s *Server) listen() {
-	s.serverRunning.Store(true)
+	var delay time.Duration
 	for {
+		if !s.waitForSlot() {
+			return
+		}
+		reserved := s.limits.slots != nil && s.overload == StopAccepting
+
 		conn, err := s.listener.Accept()
 		if err != nil {
-			if s.serverRunning.Load() {
-				panic("error when starting listening")
+			if reserved {
+				<-s.limits.slots
+			}
+			if !s.serverRunning.Load() {
+				s.logger.Info("server stopped accepting connections")
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				s.logger.Error("listener closed unexpectedly", "error", err)
+				return
 			}
-		}
 
-		go s.handle(conn)
+			delay = min(max(2*delay, minAcceptDelay), maxAcceptDelay)
+			s.logger.Warn("accept failed, retrying", "error", err, "delay", delay)
+			select {
+			case <-time.After(delay):
+			case <-s.done:
+			}
+			continue
+		}
+		delay = 0
 
+		release, ok := s.admit(conn, reserved)
+		if !ok {
+			continue
+		}
+		s.dispatch(connJob{conn, release})
 	}
 }
 
@@ -72,13 +226,149 @@ func (s *Server) handle(conn net.Conn) {
 		State:  response.StatusLine,
 	}
 
-	req, err := request.RequestFromReader(conn)
+	if s.readHeaderTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.readHeaderTimeout))
+	}
+
+	tlsState, err := handshake(conn)
 	if err != nil {
-		panic("Foo faa")
+		s.logger.Debug("TLS handshake failed", "remote_addr", conn.RemoteAddr().String(), "error", err)
+		return
 	}
 
-	s.handler(w, req)
+	var req *request.Request
+	if bufp := s.getBuffer(); bufp != nil {
+		req, err = request.RequestHeadWithBuffer(conn, *bufp)
+		if err == nil {
+			defer func() { s.putBuffer(bufp, req.ReleaseBuffer()) }()
+		} else {
+			// Whatever the parser grew the buffer into is lost with the
+			// request, but the original buffer can be reused.
+			s.putBuffer(bufp, *bufp)
+		}
+	} else {
+		req, err = request.RequestHeadFromReader(conn)
+	}
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			s.parseError(conn.RemoteAddr().String(), err)
+		}
+		// A client closing the connection without sending anything, or
+		// sending half a request, gets no answer.
+		if he := headError(err); he != nil {
+			he.writeError(w)
+		}
+		return
+	}
+	req.RemoteAddr = conn.RemoteAddr().String()
+	req.TLS = tlsState
+	// The body and the response may take as long as they need.
+	conn.SetDeadline(time.Time{})
+
+	if he := s.prepareBody(w, req); he != nil {
+		he.writeError(w)
+		return
+	}
+
+	s.serveRequest(w, req)
 
 	conn.Write([]byte("\r\n"))
 	conn.Close()
 }
+
+// serveRequest runs the handler, recovering from a panic so it only takes
+// down its own connection. The client gets a 500 if nothing was written yet.
+func (s *Server) serveRequest(w *response.Writer, req *request.Request) {
+	defer func() {
+		if v := recover(); v != nil {
+			s.logger.Error("handler panicked",
+				"remote_addr", req.RemoteAddr,
+				"method", req.RequestLine.Method,
+				"target", req.RequestLine.RequestTarget,
+				"panic", fmt.Sprint(v),
+				"stack", string(debug.Stack()),
+			)
+			if w.State == response.StatusLine {
+				he := &HandlerError{Status: int(response.InternalError), Message: response.StatusText(response.InternalError)}
+				he.writeError(w)
+			}
+		}
+	}()
+	s.handler(w, req)
+}
+
+func (s *Server) parseError(remoteAddr string, err error) {
+	s.logger.Debug("request parse failed", "remote_addr", remoteAddr, "error", err)
+	if s.parseErrorHook != nil {
+		s.parseErrorHook(err)
+	}
+}
+
+// headError maps an error reading the request head to the response sent
+// back, or nil when the client gets none.
+func headError(err error) *HandlerError {
+	switch {
+	case errors.Is(err, request.ErrHeadTooLarge):
+		return &HandlerError{Status: int(response.HeadersTooLarge), Message: err.Error()}
+	case errors.Is(err, request.ErrUnsupportedTransferCoding):
+		return &HandlerError{Status: int(response.NotImplemented), Message: err.Error()}
+	case errors.Is(err, request.ErrMalformedRequest):
+		return &HandlerError{Status: int(response.BadRequest), Message: err.Error()}
+	default:
+		return nil
+	}
+}
+
+// prepareBody decides when the request body is read. Bodies are read up
+// front, except when the client sent Expect: 100-continue and waits for
+// permission: then 100 Continue is only sent once the handler reads the body.
+func (s *Server) prepareBody(w *response.Writer, req *request.Request) *HandlerError {
+	if s.maxBodySize > 0 {
+		if int64(req.ContentLength()) > s.maxBodySize {
+			err := fmt.Errorf("%w: request body is larger than %d bytes", request.ErrBodyTooLarge, s.maxBodySize)
+			s.parseError(req.RemoteAddr, err)
+			return &HandlerError{
+				Status:  int(response.ContentTooLarge),
+				Message: fmt.Sprintf("request body is larger than %d bytes", s.maxBodySize),
+			}
+		}
+		// Chunked bodies are only checked as they are read.
+		req.SetMaxBodySize(s.maxBodySize)
+	}
+
+	expect := req.Headers.Get("Expect")
+	if expect == "" {
+		if _, err := req.ReadBody(); err != nil {
+			s.parseError(req.RemoteAddr, err)
+			status := response.BadRequest
+			switch {
+			case errors.Is(err, request.ErrBodyTooLarge):
+				status = response.ContentTooLarge
+			case errors.Is(err, request.ErrHeadTooLarge):
+				status = response.HeadersTooLarge
+			}
+			return &HandlerError{
+				Status:  int(status),
+				Message: err.Error(),
+			}
+		}
+		return nil
+	}
+
+	if !strings.EqualFold(expect, "100-continue") {
+		return &HandlerError{
+			Status:  int(response.ExpectationFailed),
+			Message: fmt.Sprintf("unsupported expectation: %s", expect),
+		}
+	}
+
+	req.BeforeBodyRead(func() error {
+		if w.State != response.StatusLine {
+			// The handler already answered, the client will not send the
+			// body after a final response.
+			return nil
+		}
+		return w.WriteInformational(response.Continue, nil)
+	})
+	return nil
+}
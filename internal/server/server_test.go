@@ -0,0 +1,277 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+func TestExpectContinue(t *testing.T) {
+	echo := func(w *response.Writer, req *request.Request) {
+		body, err := req.ReadBody()
+		if err != nil {
+			return
+		}
+		hints := headers.NewHeaders()
+		hints["Link"] = "</style.css>; rel=preload"
+		w.WriteInformational(response.EarlyHints, hints)
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody(body)
+	}
+	srv := serve(t, echo, WithMaxBodySize(100))
+
+	// Test: 100 Continue is sent before the body is read
+	conn, br := dial(t, srv)
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	// The response parser would skip the interim response and wait for the
+	// final one, so read it by hand.
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, err = br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", line)
+
+	fmt.Fprint(conn, "hello")
+	r, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+	assert.Equal(t, "hello", string(r.Body))
+	require.Len(t, r.Informational, 1)
+	assert.Equal(t, response.EarlyHints, r.Informational[0].StatusLine.StatusCode)
+
+	// Test: Unknown expectation
+	conn, br = dial(t, srv)
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nContent-Length: 5\r\nExpect: teapot\r\n\r\n")
+	r, err = response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.ExpectationFailed, r.StatusLine.StatusCode)
+
+	// Test: Body too large is rejected before it is sent
+	conn, br = dial(t, srv)
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nContent-Length: 101\r\nExpect: 100-continue\r\n\r\n")
+	r, err = response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.ContentTooLarge, r.StatusLine.StatusCode)
+	assert.Empty(t, r.Informational)
+}
+
+func TestExpectContinueNotRead(t *testing.T) {
+	reject := func(w *response.Writer, req *request.Request) {
+		body := "no thanks"
+		w.WriteStatusLine(response.Forbidden)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody([]byte(body))
+	}
+	srv := serve(t, reject)
+
+	// Test: Handler answers without reading the body, so no 100 Continue
+	conn, br := dial(t, srv)
+	fmt.Fprint(conn, "PUT / HTTP/1.1\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	r, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Forbidden, r.StatusLine.StatusCode)
+	assert.Empty(t, r.Informational)
+}
+
+func serve(t *testing.T, handler Handler, opts ...Option) *Server {
+	t.Helper()
+	srv, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func dial(t *testing.T, srv *Server) (io.Writer, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, bufio.NewReader(conn)
+}
+
+func TestRequestFraming(t *testing.T) {
+	echo := func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(req.Body), "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody(req.Body)
+	}
+	srv := serve(t, echo, WithMaxBodySize(10))
+
+	for _, tc := range []struct {
+		name   string
+		raw    string
+		status response.StatusCode
+	}{
+		{"chunked body", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n", response.Ok},
+		{"Content-Length and Transfer-Encoding", "POST / HTTP/1.1\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n", response.BadRequest},
+		{"unsupported transfer coding", "POST / HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n", response.NotImplemented},
+		{"head too large", "GET /" + strings.Repeat("a", 64<<10), response.HeadersTooLarge},
+		{"chunked body too large", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nhello \r\n6\r\nworld!\r\n0\r\n\r\n", response.ContentTooLarge},
+		{"trailers too large", "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n" + strings.Repeat("X-A: b\r\n", 10<<10), response.HeadersTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, br := dial(t, srv)
+			fmt.Fprint(conn, tc.raw)
+			r, err := response.ParseFromReader(br)
+			require.NoError(t, err)
+			assert.Equal(t, tc.status, r.StatusLine.StatusCode)
+			if tc.status == response.Ok {
+				assert.Equal(t, "hello", string(r.Body))
+			}
+		})
+	}
+}
+
+func TestParseErrorHook(t *testing.T) {
+	errs := make(chan error, 1)
+	srv := serve(t, func(w *response.Writer, req *request.Request) {}, WithParseErrorHook(func(err error) { errs <- err }))
+
+	// Test: Malformed head
+	conn, br := dial(t, srv)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nno colon\r\n\r\n")
+	r, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.BadRequest, r.StatusLine.StatusCode)
+	assert.ErrorIs(t, <-errs, request.ErrMalformedRequest)
+
+	// Test: Connections closed without a request are not reported
+	c, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	c.Close()
+	conn, br = dial(t, srv)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: x")
+	conn.(net.Conn).Close()
+	assert.ErrorIs(t, <-errs, io.ErrUnexpectedEOF)
+}
+
+// logBuffer collects log output written from connection goroutines.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func newLogger(out io.Writer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestHandlerPanic(t *testing.T) {
+	logs := &logBuffer{}
+	srv := serve(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/panic" {
+			panic("boom")
+		}
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(0, "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+	}, WithLogger(newLogger(logs)))
+
+	// Test: The client gets a 500 and the panic is logged with its stack
+	conn, br := dial(t, srv)
+	fmt.Fprint(conn, "GET /panic HTTP/1.1\r\n\r\n")
+	r, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.InternalError, r.StatusLine.StatusCode)
+	assert.Contains(t, logs.String(), `msg="handler panicked"`)
+	assert.Contains(t, logs.String(), "target=/panic panic=boom")
+	assert.Contains(t, logs.String(), "server.(*Server).serveRequest")
+
+	// Test: The server keeps serving
+	conn, br = dial(t, srv)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\n\r\n")
+	r, err = response.ParseFromReader(br)
+	require.NoError(t, err)
+	assert.Equal(t, response.Ok, r.StatusLine.StatusCode)
+}
+
+func TestLogging(t *testing.T) {
+	logs := &logBuffer{}
+	srv := serve(t, func(w *response.Writer, req *request.Request) {}, WithLogger(newLogger(logs)))
+	assert.Contains(t, logs.String(), `msg="server listening" addr=`+srv.Addr().String())
+
+	// Test: Parse failures are logged with the client address
+	conn, br := dial(t, srv)
+	fmt.Fprint(conn, "GET / HTTP/1.1\r\nno colon\r\n\r\n")
+	_, err := response.ParseFromReader(br)
+	require.NoError(t, err)
+	local := conn.(net.Conn).LocalAddr().String()
+	assert.Contains(t, logs.String(), `level=DEBUG msg="request parse failed" remote_addr=`+local)
+
+	// Test: Shutdown
+	srv.Close()
+	assert.Contains(t, logs.String(), `msg="server shutting down"`)
+	assert.Eventually(t, func() bool {
+		return bytes.Contains([]byte(logs.String()), []byte(`msg="server stopped accepting connections"`))
+	}, time.Second, time.Millisecond)
+}
+
+// failingListener fails every Accept with err, then with net.ErrClosed.
+type failingListener struct {
+	net.Listener
+	err      error
+	failures int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if l.failures == 0 {
+		return nil, net.ErrClosed
+	}
+	l.failures--
+	return nil, l.err
+}
+
+func TestAcceptErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	logs := &logBuffer{}
+	s := &Server{
+		listener: &failingListener{ln, errors.New("too many open files"), 3},
+		done:     make(chan struct{}),
+		logger:   newLogger(logs),
+	}
+	s.initLimits()
+	s.serverRunning.Store(true)
+
+	// Test: Errors are retried with growing delays until the listener is
+	// gone, instead of crashing the process
+	s.listen()
+	out := logs.String()
+	assert.Equal(t, 3, strings.Count(out, `msg="accept failed, retrying" error="too many open files"`))
+	assert.Contains(t, out, "delay=5ms")
+	assert.Contains(t, out, "delay=10ms")
+	assert.Contains(t, out, "delay=20ms")
+	assert.Contains(t, out, `level=ERROR msg="listener closed unexpectedly"`)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+// ClientAuthMode controls whether TLS clients must present a certificate.
+type ClientAuthMode int
+
+const (
+	// NoClientCert does not ask clients for a certificate.
+	NoClientCert ClientAuthMode = iota
+	// OptionalClientCert asks for a certificate and verifies it if one is sent.
+	OptionalClientCert
+	// RequireClientCert rejects handshakes without a verified certificate.
+	RequireClientCert
+)
+
+// WithTLS makes the server accept TLS connections using config.
+func WithTLS(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+// WithClientAuth verifies client certificates against pool. It requires
+// WithTLS to be set as well.
+func WithClientAuth(pool *x509.CertPool, mode ClientAuthMode) Option {
+	return func(s *Server) {
+		s.clientCAs = pool
+		s.clientAuth = mode
+	}
+}
+
+// LoadTLSConfig returns a tls.Config serving the certificate in certFile and
+// keyFile.
+func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading key pair: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// LoadCertPool reads PEM encoded CA certificates from files into a pool.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+
+	return pool, nil
+}
+
+func (s *Server) buildTLSConfig() (*tls.Config, error) {
+	if s.clientAuth == NoClientCert {
+		return s.tlsConfig, nil
+	}
+
+	if s.tlsConfig == nil {
+		return nil, fmt.Errorf("client authentication requires TLS")
+	}
+	if s.clientCAs == nil {
+		return nil, fmt.Errorf("client authentication requires a CA pool")
+	}
+
+	config := s.tlsConfig.Clone()
+	config.ClientCAs = s.clientCAs
+	switch s.clientAuth {
+	case OptionalClientCert:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case RequireClientCert:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode: %d", s.clientAuth)
+	}
+
+	return config, nil
+}
+
+// handshake completes the TLS handshake on conn, if it is a TLS connection,
+// and returns the resulting connection state.
+func handshake(conn net.Conn) (*tls.ConnectionState, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, nil
+	}
+
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+
+	state := tlsConn.ConnectionState()
+	return &state, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+)
+
+func TestClientAuth(t *testing.T) {
+	ca, caKey := newCert(t, "test ca", nil, nil)
+	serverCert := newLeaf(t, "localhost", ca, caKey)
+	clientCert := newLeaf(t, "client", ca, caKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	handler := func(w *response.Writer, req *request.Request) {
+		body := req.ClientSubject()
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody([]byte(body))
+	}
+
+	// Test: Required client cert is exposed to the handler
+	srv := serveTLS(t, handler, serverCert, pool, RequireClientCert)
+	resp, err := tlsGet(srv, pool, &clientCert)
+	require.NoError(t, err)
+	assert.Contains(t, resp, "HTTP/1.1 200 OK")
+	assert.Contains(t, resp, "CN=client")
+
+	// Test: Required client cert is missing
+	_, err = tlsGet(srv, pool, nil)
+	require.Error(t, err)
+
+	// Test: Optional client cert is missing
+	srv = serveTLS(t, handler, serverCert, pool, OptionalClientCert)
+	resp, err = tlsGet(srv, pool, nil)
+	require.NoError(t, err)
+	assert.Contains(t, resp, "HTTP/1.1 200 OK")
+	assert.NotContains(t, resp, "CN=")
+
+	// Test: Client cert signed by an unknown CA
+	otherCA, otherKey := newCert(t, "other ca", nil, nil)
+	strangerCert := newLeaf(t, "stranger", otherCA, otherKey)
+	_, err = tlsGet(srv, pool, &strangerCert)
+	require.Error(t, err)
+
+	// Test: Client auth without TLS
+	_, err = Serve(0, handler, WithClientAuth(pool, RequireClientCert))
+	require.Error(t, err)
+}
+
+func serveTLS(t *testing.T, handler Handler, cert tls.Certificate, pool *x509.CertPool, mode ClientAuthMode) *Server {
+	t.Helper()
+	srv, err := Serve(0, handler,
+		WithTLS(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		WithClientAuth(pool, mode),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func tlsGet(srv *Server, roots *x509.CertPool, cert *tls.Certificate) (string, error) {
+	config := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if cert != nil {
+		// Send the certificate even if the server does not list its issuer
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+	}
+
+	port := srv.Addr().(*net.TCPAddr).Port
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := io.ReadAll(conn)
+	return string(resp), err
+}
+
+func newCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{cn},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func newLeaf(t *testing.T, cn string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) tls.Certificate {
+	t.Helper()
+	cert, key := newCert(t, cn, ca, caKey)
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+}
@@ -0,0 +1,108 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCookie = errors.New("invalid session cookie")
+
+// cookieData is what gets encrypted into the cookie.
+type cookieData struct {
+	Values   map[string]string `json:"v"`
+	Created  int64             `json:"c"`
+	LastSeen int64             `json:"l"`
+}
+
+// CookieBackend keeps the whole session in the cookie, sealed with AES-GCM.
+type CookieBackend struct {
+	aeads []cipher.AEAD
+}
+
+// NewCookieBackend encrypts with the first key and decrypts with any of
+// them, so keys can be rotated by prepending a new one and dropping the
+// oldest once its cookies have expired. Keys must be 16, 24 or 32 bytes.
+func NewCookieBackend(keys ...[]byte) (*CookieBackend, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+
+	b := &CookieBackend{}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		b.aeads = append(b.aeads, aead)
+	}
+
+	return b, nil
+}
+
+func (b *CookieBackend) Load(value string) (*Session, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	for _, aead := range b.aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			continue
+		}
+
+		var data cookieData
+		if err := json.Unmarshal(plaintext, &data); err != nil {
+			return nil, ErrInvalidCookie
+		}
+		if data.Values == nil {
+			data.Values = map[string]string{}
+		}
+		return &Session{
+			Values:   data.Values,
+			Created:  time.Unix(data.Created, 0),
+			LastSeen: time.Unix(data.LastSeen, 0),
+		}, nil
+	}
+
+	return nil, ErrInvalidCookie
+}
+
+func (b *CookieBackend) Save(s *Session, _ time.Duration) (string, error) {
+	plaintext, err := json.Marshal(cookieData{
+		Values:   s.Values,
+		Created:  s.Created.Unix(),
+		LastSeen: s.LastSeen.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	aead := b.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Remove does nothing: expiring the cookie is all it takes.
+func (b *CookieBackend) Remove(*Session) error {
+	return nil
+}
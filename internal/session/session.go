@@ -0,0 +1,225 @@
+// Package session keeps per-client state across requests
+package session
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"httpFromTcp/internal/cookie"
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+const (
+	defaultCookieName  = "session"
+	defaultIdleTimeout = 30 * time.Minute
+	defaultMaxLifetime = 24 * time.Hour
+)
+
+// Session holds the values stored for one client.
+type Session struct {
+	ID       string
+	Values   map[string]string
+	Created  time.Time
+	LastSeen time.Time
+
+	isNew     bool
+	changed   bool
+	destroyed bool
+	renewed   string
+}
+
+func (s *Session) Get(key string) string {
+	return s.Values[key]
+}
+
+func (s *Session) Set(key, value string) {
+	s.Values[key] = value
+	s.changed = true
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.Values, key)
+	s.changed = true
+}
+
+// Destroy removes the session and expires its cookie.
+func (s *Session) Destroy() {
+	s.destroyed = true
+}
+
+// RenewID gives the session a new ID while keeping its values. Call it when
+// the privilege level changes, such as on login, to prevent session
+// fixation. It has no effect with cookie storage, which has no IDs.
+func (s *Session) RenewID() {
+	s.renewed = s.ID
+	s.ID = ""
+	s.changed = true
+}
+
+// Backend loads and saves sessions from the cookie value.
+type Backend interface {
+	// Load returns the session for a cookie value, or an error if the
+	// value does not identify a stored session.
+	Load(value string) (*Session, error)
+	// Save stores s and returns the cookie value identifying it.
+	Save(s *Session, ttl time.Duration) (string, error)
+	// Remove deletes s from storage.
+	Remove(s *Session) error
+}
+
+type config struct {
+	cookie      cookie.Cookie
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	now         func() time.Time
+}
+
+type Option func(*config)
+
+// WithCookie sets the name and attributes of the session cookie. Value,
+// Expires and MaxAge are managed by the middleware.
+func WithCookie(c cookie.Cookie) Option {
+	return func(cfg *config) {
+		cfg.cookie = c
+	}
+}
+
+// WithIdleTimeout ends sessions that were not used for d.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.idleTimeout = d
+	}
+}
+
+// WithMaxLifetime ends sessions d after they were created, however active
+// they are.
+func WithMaxLifetime(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.maxLifetime = d
+	}
+}
+
+type contextKey struct{}
+
+// FromRequest returns the session attached by the middleware, or nil.
+func FromRequest(req *request.Request) *Session {
+	s, _ := req.Context().Value(contextKey{}).(*Session)
+	return s
+}
+
+// New returns a middleware attaching a session to every request. Changes
+// are saved when the response headers are written, so handlers must modify
+// the session before calling WriteHeaders.
+func New(backend Backend, opts ...Option) server.Middleware {
+	cfg := &config{
+		cookie: cookie.Cookie{
+			Name:     defaultCookieName,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: cookie.SameSiteLax,
+		},
+		idleTimeout: defaultIdleTimeout,
+		maxLifetime: defaultMaxLifetime,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			s := cfg.load(backend, req)
+			req.SetContext(context.WithValue(req.Context(), contextKey{}, s))
+
+			w.OnHeaders(func(_ response.StatusCode, _ headers.Headers) {
+				cfg.save(backend, w, s)
+			})
+
+			next(w, req)
+		}
+	}
+}
+
+func (cfg *config) load(backend Backend, req *request.Request) *Session {
+	now := cfg.now()
+	if c, ok := req.Cookie(cfg.cookie.Name); ok {
+		s, err := backend.Load(c.Value)
+		if err == nil && !cfg.expired(s, now) {
+			// Stores may hand back the flags of the request that saved it.
+			s.isNew, s.changed, s.destroyed, s.renewed = false, false, false, ""
+			s.LastSeen = now
+			return s
+		}
+		if err == nil {
+			backend.Remove(s)
+		}
+	}
+
+	return &Session{
+		Values:   map[string]string{},
+		Created:  now,
+		LastSeen: now,
+		isNew:    true,
+	}
+}
+
+func (cfg *config) expired(s *Session, now time.Time) bool {
+	if cfg.idleTimeout > 0 && now.Sub(s.LastSeen) > cfg.idleTimeout {
+		return true
+	}
+	return cfg.maxLifetime > 0 && now.Sub(s.Created) > cfg.maxLifetime
+}
+
+func (cfg *config) save(backend Backend, w *response.Writer, s *Session) {
+	c := cfg.cookie
+
+	if s.destroyed {
+		if !s.isNew {
+			backend.Remove(s)
+			c.MaxAge = -1
+			w.SetCookie(&c)
+		}
+		return
+	}
+
+	// Untouched new sessions are not worth a cookie.
+	if s.isNew && !s.changed {
+		return
+	}
+	if s.renewed != "" {
+		backend.Remove(&Session{ID: s.renewed})
+	}
+
+	ttl := cfg.ttl(s)
+	value, err := backend.Save(s, ttl)
+	if err != nil {
+		return
+	}
+
+	c.Value = value
+	c.MaxAge = int(ttl.Seconds())
+	w.SetCookie(&c)
+}
+
+// ttl is how long the session stays valid if the client does nothing more.
+// It is 0 when neither timeout is set and the session never expires.
+func (cfg *config) ttl(s *Session) time.Duration {
+	ttl := cfg.idleTimeout
+	if cfg.maxLifetime > 0 {
+		remaining := s.Created.Add(cfg.maxLifetime).Sub(s.LastSeen)
+		if ttl <= 0 || remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return ttl
+}
+
+func cloneSession(s *Session) *Session {
+	c := *s
+	c.Values = maps.Clone(s.Values)
+	return &c
+}
@@ -0,0 +1,240 @@
+package session
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// counter increments a visit count, or runs action on the session first.
+func counter(action func(*Session)) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		s := FromRequest(req)
+		if action != nil {
+			action(s)
+		}
+		s.Set("visits", s.Get("visits")+"x")
+
+		body := s.Get("visits")
+		w.WriteStatusLine(response.Ok)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body), "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody([]byte(body))
+	}
+}
+
+var setCookieRe = regexp.MustCompile(`Set-Cookie: session=([^;]*);([^\r]*)`)
+
+// visit runs one request with the given cookie value and returns the body
+// and the new cookie value and attributes, if any.
+func visit(t *testing.T, handler server.Handler, value string) (string, string, string) {
+	t.Helper()
+	raw := "GET / HTTP/1.1\r\n"
+	if value != "" {
+		raw += "Cookie: session=" + value + "\r\n"
+	}
+	req, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	handler(&response.Writer{Writer: out, State: response.StatusLine}, req)
+
+	body := out.String()[strings.Index(out.String(), "\r\n\r\n")+4:]
+	m := setCookieRe.FindStringSubmatch(out.String())
+	if m == nil {
+		return body, "", ""
+	}
+	return body, m[1], m[2]
+}
+
+func TestCookieBackend(t *testing.T) {
+	backend, err := NewCookieBackend(testKey)
+	require.NoError(t, err)
+	handler := New(backend)(counter(nil))
+
+	// Test: Values survive round trips
+	body, value, attrs := visit(t, handler, "")
+	assert.Equal(t, "x", body)
+	require.NotEmpty(t, value)
+	assert.Contains(t, attrs, "HttpOnly")
+	assert.Contains(t, attrs, "Path=/")
+	assert.NotContains(t, value, "visits")
+
+	body, value, _ = visit(t, handler, value)
+	assert.Equal(t, "xx", body)
+
+	// Test: Tampered cookie starts a new session
+	tampered := []byte(value)
+	tampered[len(tampered)/2] ^= 1
+	body, _, _ = visit(t, handler, string(tampered))
+	assert.Equal(t, "x", body)
+
+	// Test: Key rotation
+	rotated, err := NewCookieBackend([]byte("fedcba9876543210"), testKey)
+	require.NoError(t, err)
+	body, value, _ = visit(t, New(rotated)(counter(nil)), value)
+	assert.Equal(t, "xxx", body)
+
+	// Test: Old key alone cannot read cookies sealed with the new one
+	body, _, _ = visit(t, handler, value)
+	assert.Equal(t, "x", body)
+
+	// Test: Invalid keys
+	_, err = NewCookieBackend([]byte("short"))
+	assert.Error(t, err)
+	_, err = NewCookieBackend()
+	assert.Error(t, err)
+}
+
+func TestExpiry(t *testing.T) {
+	backend, err := NewCookieBackend(testKey)
+	require.NoError(t, err)
+
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+	handler := New(backend,
+		WithIdleTimeout(10*time.Minute),
+		WithMaxLifetime(time.Hour),
+		withClock(clock),
+	)(counter(nil))
+
+	_, value, attrs := visit(t, handler, "")
+	assert.Contains(t, attrs, "Max-Age=600")
+
+	// Test: Activity keeps the session alive
+	for range 5 {
+		now = now.Add(9 * time.Minute)
+		_, value, _ = visit(t, handler, value)
+	}
+	body, value, attrs := visit(t, handler, value)
+	assert.Equal(t, "xxxxxxx", body)
+
+	// Test: Cookie lifetime is capped by the absolute expiry
+	now = now.Add(9 * time.Minute)
+	_, value, attrs = visit(t, handler, value)
+	assert.Contains(t, attrs, "Max-Age=360")
+
+	// Test: Absolute expiry
+	now = now.Add(7 * time.Minute)
+	body, _, _ = visit(t, handler, value)
+	assert.Equal(t, "x", body)
+
+	// Test: Idle expiry
+	_, value, _ = visit(t, handler, "")
+	now = now.Add(11 * time.Minute)
+	body, _, _ = visit(t, handler, value)
+	assert.Equal(t, "x", body)
+}
+
+func TestStoreBackend(t *testing.T) {
+	store := NewMemoryStore(0)
+	defer store.Close()
+	handler := New(NewStoreBackend(store))(counter(nil))
+
+	// Test: Only the ID goes in the cookie
+	body, id, _ := visit(t, handler, "")
+	assert.Equal(t, "x", body)
+	assert.Len(t, id, 43)
+	assert.Equal(t, 1, store.Len())
+
+	body, same, _ := visit(t, handler, id)
+	assert.Equal(t, "xx", body)
+	assert.Equal(t, id, same)
+
+	// Test: Unknown IDs start a new session
+	body, other, _ := visit(t, handler, "forged")
+	assert.Equal(t, "x", body)
+	assert.NotEqual(t, "forged", other)
+
+	// Test: RenewID keeps values under a new ID
+	renew := New(NewStoreBackend(store))(counter(func(s *Session) { s.RenewID() }))
+	body, renewed, _ := visit(t, renew, id)
+	assert.Equal(t, "xxx", body)
+	assert.NotEqual(t, id, renewed)
+	_, err := store.Get(id)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Test: Destroy expires the cookie and drops the data
+	destroy := New(NewStoreBackend(store))(counter(func(s *Session) { s.Destroy() }))
+	_, value, attrs := visit(t, destroy, renewed)
+	assert.Empty(t, value)
+	assert.Contains(t, attrs, "Max-Age=0")
+	_, err = store.Get(renewed)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore(0)
+	defer store.Close()
+	now := time.Unix(1_700_000_000, 0)
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Set(&Session{ID: "a", Values: map[string]string{"k": "v"}}, time.Minute))
+	require.NoError(t, store.Set(&Session{ID: "b", Values: map[string]string{}}, time.Hour))
+	require.NoError(t, store.Set(&Session{ID: "c", Values: map[string]string{}}, 0))
+
+	s, err := store.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, "v", s.Get("k"))
+
+	// Test: Returned sessions are copies
+	s.Set("k", "changed")
+	s, _ = store.Get("a")
+	assert.Equal(t, "v", s.Get("k"))
+
+	// Test: Sweep drops expired entries
+	now = now.Add(2 * time.Minute)
+	store.sweep()
+	assert.Equal(t, 2, store.Len())
+	_, err = store.Get("a")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Test: A ttl of 0 never expires
+	now = now.Add(24 * 365 * time.Hour)
+	store.sweep()
+	assert.Equal(t, 1, store.Len())
+	_, err = store.Get("c")
+	assert.NoError(t, err)
+}
+
+func TestNoExpiry(t *testing.T) {
+	store := NewMemoryStore(0)
+	defer store.Close()
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+	store.now = clock
+	handler := New(NewStoreBackend(store),
+		WithIdleTimeout(0),
+		WithMaxLifetime(0),
+		withClock(clock),
+	)(counter(nil))
+
+	// Test: Without timeouts the cookie lasts for the browser session
+	_, id, attrs := visit(t, handler, "")
+	assert.NotContains(t, attrs, "Max-Age")
+
+	// Test: The session survives later requests however late
+	now = now.Add(time.Second)
+	body, _, _ := visit(t, handler, id)
+	assert.Equal(t, "xx", body)
+	now = now.Add(30 * 24 * time.Hour)
+	body, _, _ = visit(t, handler, id)
+	assert.Equal(t, "xxx", body)
+}
+
+func withClock(now func() time.Time) Option {
+	return func(cfg *config) {
+		cfg.now = now
+	}
+}
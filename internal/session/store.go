@@ -0,0 +1,168 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("session not found")
+
+// Store keeps sessions on the server side, keyed by ID.
+type Store interface {
+	Get(id string) (*Session, error)
+	// Set stores s for ttl. A ttl of 0 or less keeps it until deleted.
+	Set(s *Session, ttl time.Duration) error
+	Delete(id string) error
+}
+
+// StoreBackend keeps sessions in a Store and only puts a random ID in the
+// cookie.
+type StoreBackend struct {
+	store Store
+}
+
+func NewStoreBackend(store Store) *StoreBackend {
+	return &StoreBackend{store}
+}
+
+func (b *StoreBackend) Load(value string) (*Session, error) {
+	return b.store.Get(value)
+}
+
+func (b *StoreBackend) Save(s *Session, ttl time.Duration) (string, error) {
+	if s.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return "", err
+		}
+		s.ID = id
+	}
+
+	if err := b.store.Set(s, ttl); err != nil {
+		return "", err
+	}
+	return s.ID, nil
+}
+
+func (b *StoreBackend) Remove(s *Session) error {
+	if s.ID == "" {
+		return nil
+	}
+	return b.store.Delete(s.ID)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type memoryEntry struct {
+	session *Session
+	expires time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// MemoryStore is a Store living in process memory. Expired sessions are
+// dropped lazily and by a periodic sweep.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+	now      func() time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMemoryStore returns a store sweeping expired sessions every interval.
+// Call Close to stop the sweeper.
+func NewMemoryStore(interval time.Duration) *MemoryStore {
+	m := &MemoryStore{
+		sessions: map[string]memoryEntry{},
+		now:      time.Now,
+		stop:     make(chan struct{}),
+	}
+	if interval > 0 {
+		go m.sweepLoop(interval)
+	}
+	return m
+}
+
+func (m *MemoryStore) Get(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if entry.expired(m.now()) {
+		delete(m.sessions, id)
+		return nil, ErrNotFound
+	}
+	// Hand out a copy so concurrent requests do not share the map.
+	return cloneSession(entry.session), nil
+}
+
+func (m *MemoryStore) Set(s *Session, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = m.now().Add(ttl)
+	}
+	m.sessions[s.ID] = memoryEntry{cloneSession(s), expires}
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// Len returns the number of stored sessions, expired or not.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+func (m *MemoryStore) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+func (m *MemoryStore) sweepLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.sweep()
+		}
+	}
+}
+
+func (m *MemoryStore) sweep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for id, entry := range m.sessions {
+		if entry.expired(now) {
+			delete(m.sessions, id)
+		}
+	}
+}
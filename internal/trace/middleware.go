@@ -0,0 +1,83 @@
+package trace
+
+import (
+	"strings"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+type config struct {
+	route func(*request.Request) string
+}
+
+type Option func(*config)
+
+// WithRoute names the route of a request, such as "/assets/", for the
+// span name and the http.route attribute. Without it spans are named after
+// the method alone.
+func WithRoute(fn func(*request.Request) string) Option {
+	return func(c *config) {
+		c.route = fn
+	}
+}
+
+// New returns a middleware starting a server span for every request, as a
+// child of the traceparent the client sent, if any. Handlers reach the span
+// with SpanFromRequest and pass it on through req.Context().
+func New(t *Tracer, opts ...Option) server.Middleware {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			ctx := req.Context()
+			if sc, ok := Extract(req); ok {
+				ctx = ContextWithRemote(ctx, sc)
+			}
+
+			method := req.RequestLine.Method
+			name := method
+			route := ""
+			if c.route != nil {
+				route = c.route(req)
+				name += " " + route
+			}
+
+			ctx, span := t.Start(ctx, name, Server)
+			req.SetContext(ctx)
+			defer span.End()
+
+			path, query, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+			span.SetAttribute("http.request.method", method)
+			span.SetAttribute("url.path", path)
+			if query != "" {
+				span.SetAttribute("url.query", query)
+			}
+			if route != "" {
+				span.SetAttribute("http.route", route)
+			}
+			span.SetAttribute("network.protocol.version", req.RequestLine.HTTPVersion)
+			span.SetAttribute("client.address", req.RemoteIP())
+			if ua := req.Headers.Get("User-Agent"); ua != "" {
+				span.SetAttribute("user_agent.original", ua)
+			}
+
+			next(w, req)
+
+			status := w.Status()
+			span.SetAttribute("http.response.status_code", int(status))
+			span.SetAttribute("http.response.body.size", w.BytesWritten())
+			// Client errors are the client's fault, not the server's.
+			switch {
+			case status == 0:
+				span.SetStatus(Error, "no response written")
+			case status >= 500:
+				span.SetStatus(Error, response.StatusText(status))
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package trace
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+)
+
+// Header names from W3C Trace Context.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const (
+	traceparentLen = 55
+	// maxTracestateMembers is the most list members a tracestate may have.
+	maxTracestateMembers = 32
+)
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses a traceparent header. Versions above 00 are read
+// as version 00, ignoring anything after the known fields, as the
+// specification asks.
+func ParseTraceparent(s string) (SpanContext, error) {
+	s = strings.Trim(s, " \t")
+	if len(s) < traceparentLen {
+		return SpanContext{}, fmt.Errorf("%w: %q", ErrInvalidTraceparent, s)
+	}
+
+	version, ok := parseHex(s[:2])
+	if !ok || len(version) != 1 || version[0] == 0xff {
+		return SpanContext{}, fmt.Errorf("%w: bad version: %q", ErrInvalidTraceparent, s)
+	}
+	if version[0] == 0 && len(s) != traceparentLen || len(s) > traceparentLen && s[traceparentLen] != '-' {
+		return SpanContext{}, fmt.Errorf("%w: bad length: %q", ErrInvalidTraceparent, s)
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return SpanContext{}, fmt.Errorf("%w: %q", ErrInvalidTraceparent, s)
+	}
+
+	var sc SpanContext
+	traceID, ok1 := parseHex(s[3:35])
+	spanID, ok2 := parseHex(s[36:52])
+	flags, ok3 := parseHex(s[53:55])
+	if !ok1 || !ok2 || !ok3 {
+		return SpanContext{}, fmt.Errorf("%w: %q", ErrInvalidTraceparent, s)
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("%w: all-zero id: %q", ErrInvalidTraceparent, s)
+	}
+	sc.Remote = true
+
+	return sc, nil
+}
+
+// parseHex decodes lowercase hex, the only case traceparent allows.
+func parseHex(s string) ([]byte, bool) {
+	if strings.ToLower(s) != s {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// Traceparent formats sc as a version 00 traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTracestate validates a tracestate header and returns it with empty
+// list members removed. An invalid tracestate is discarded as a whole.
+func ParseTracestate(s string) (string, bool) {
+	var members []string
+	seen := map[string]bool{}
+	for _, m := range strings.Split(s, ",") {
+		m = strings.Trim(m, " \t")
+		if m == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(m, "=")
+		if !ok || !validKey(key) || !validValue(value) || seen[key] {
+			return "", false
+		}
+		seen[key] = true
+		members = append(members, m)
+	}
+	if len(members) > maxTracestateMembers {
+		return "", false
+	}
+	return strings.Join(members, ","), true
+}
+
+// validKey checks a tracestate key: a simple key, or a multi-tenant key
+// written tenant@system.
+func validKey(key string) bool {
+	tenant, system, multi := strings.Cut(key, "@")
+	if !multi {
+		return len(key) <= 256 && validKeyPart(key, true)
+	}
+	return len(tenant) <= 241 && validKeyPart(tenant, false) &&
+		len(system) <= 14 && validKeyPart(system, true)
+}
+
+func validKeyPart(s string, letterFirst bool) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		lower, digit := 'a' <= c && c <= 'z', '0' <= c && c <= '9'
+		if i == 0 && letterFirst && !lower || i == 0 && !lower && !digit {
+			return false
+		}
+		if !lower && !digit && c != '_' && c != '-' && c != '*' && c != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// validValue checks a tracestate value: up to 256 printable ASCII
+// characters other than comma and equals, not ending in a space.
+func validValue(v string) bool {
+	if v == "" || len(v) > 256 || v[len(v)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] < ' ' || v[i] > '~' || v[i] == ',' || v[i] == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract returns the remote span context sent with req, if it has a valid
+// traceparent header.
+func Extract(req *request.Request) (SpanContext, bool) {
+	sc, err := ParseTraceparent(req.Headers.Get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	if ts, ok := ParseTracestate(req.Headers.Get(TracestateHeader)); ok {
+		sc.TraceState = ts
+	}
+	return sc, true
+}
+
+// Inject sets the traceparent and tracestate headers for sc, replacing
+// any already in h.
+func Inject(sc SpanContext, h headers.Headers) {
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
@@ -0,0 +1,87 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/headers"
+	"httpFromTcp/internal/request"
+)
+
+const validParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent(validParent)
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled())
+	assert.True(t, sc.Remote)
+	assert.Equal(t, validParent, sc.Traceparent())
+
+	// Test: Future versions may append fields
+	sc, err = ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-what-the-future-holds")
+	require.NoError(t, err)
+	assert.False(t, sc.Sampled())
+
+	// Test: Invalid
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+		"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.x",
+	} {
+		_, err := ParseTraceparent(s)
+		require.ErrorIs(t, err, ErrInvalidTraceparent, s)
+	}
+}
+
+func TestParseTracestate(t *testing.T) {
+	ts, ok := ParseTracestate("congo=t61rcWkgMzE, ,rojo=00f067aa0ba902b7,tenant@vendor=x")
+	require.True(t, ok)
+	assert.Equal(t, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7,tenant@vendor=x", ts)
+
+	// Test: Invalid lists are discarded
+	for _, s := range []string{
+		"Congo=x",
+		"congo",
+		"congo=a,congo=b",
+		"congo=a=b",
+		"congo=bad\x7f",
+		"1abc=x",
+		"tenant@Vendor=x",
+		strings.TrimSuffix(strings.Repeat("a=1,b=1,", 17), ","),
+	} {
+		_, ok := ParseTracestate(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\n" +
+		"traceparent: " + validParent + "\r\n" +
+		"tracestate: rojo=00f067aa0ba902b7\r\n\r\n"))
+	require.NoError(t, err)
+
+	sc, ok := Extract(req)
+	require.True(t, ok)
+	assert.Equal(t, "rojo=00f067aa0ba902b7", sc.TraceState)
+
+	h := headers.Headers{"traceparent": "stale", "tracestate": "stale=1"}
+	Inject(sc, h)
+	assert.Equal(t, validParent, h.Get("traceparent"))
+	assert.Equal(t, "rojo=00f067aa0ba902b7", h.Get("tracestate"))
+
+	// Test: Invalid traceparent drops tracestate too
+	req.Headers.Set("traceparent", "garbage")
+	_, ok = Extract(req)
+	assert.False(t, ok)
+}
@@ -0,0 +1,254 @@
+// Package trace records spans following W3C Trace Context, compatible with
+// OpenTelemetry.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"httpFromTcp/internal/request"
+)
+
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id TraceID) IsValid() bool  { return id != TraceID{} }
+
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) IsValid() bool  { return id != SpanID{} }
+
+// FlagSampled is the traceparent flag telling the trace is recorded.
+const FlagSampled byte = 0x01
+
+// SpanContext identifies a span and carries what is propagated with it.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	// Remote is set for span contexts received from another process.
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Kind is the role of a span, numbered as in OTLP.
+type Kind int
+
+const (
+	Internal Kind = 1
+	Server   Kind = 2
+	Client   Kind = 3
+)
+
+// StatusCode is the outcome of a span, numbered as in OTLP.
+type StatusCode int
+
+const (
+	Unset StatusCode = 0
+	Ok    StatusCode = 1
+	Error StatusCode = 2
+)
+
+// Attribute is a key and a string, bool, int, int64 or float64 value.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanData is a finished span as handed to exporters.
+type SpanData struct {
+	Name          string
+	Kind          Kind
+	SpanContext   SpanContext
+	Parent        SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Span is an operation being traced. All methods do nothing on a nil span,
+// which is what callers get when tracing is off.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the span's identity, for propagation.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttribute records key, replacing any earlier value.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data.Attributes {
+		if s.data.Attributes[i].Key == key {
+			s.data.Attributes[i].Value = value
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{key, value})
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Status = code
+	if code == Error {
+		s.data.StatusMessage = message
+	}
+	s.mu.Unlock()
+}
+
+// End finishes the span and exports it if it is sampled. Calls after the
+// first do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.Sampled() {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// Tracer starts spans and hands them to an exporter once they end.
+type Tracer struct {
+	exporter Exporter
+	now      func() time.Time
+	newIDs   func() (TraceID, SpanID)
+}
+
+type TracerOption func(*Tracer)
+
+func NewTracer(exporter Exporter, opts ...TracerOption) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		now:      time.Now,
+		newIDs:   randomIDs,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Start starts a span. Its parent is the span in ctx, or else the remote
+// span context in ctx; without either it starts a new, sampled trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	traceID, spanID := t.newIDs()
+	sc := SpanContext{TraceID: traceID, SpanID: spanID, Flags: FlagSampled}
+
+	var parent SpanID
+	if p, ok := parentFrom(ctx); ok {
+		sc.TraceID, sc.Flags, sc.TraceState = p.TraceID, p.Flags, p.TraceState
+		parent = p.SpanID
+	}
+
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       t.now(),
+		},
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+// Shutdown flushes and closes the exporter.
+func (t *Tracer) Shutdown() error {
+	return t.exporter.Shutdown()
+}
+
+func randomIDs() (TraceID, SpanID) {
+	var traceID TraceID
+	var spanID SpanID
+	for !traceID.IsValid() {
+		rand.Read(traceID[:])
+	}
+	for !spanID.IsValid() {
+		rand.Read(spanID[:])
+	}
+	return traceID, spanID
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan returns ctx carrying s.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// ContextWithRemote returns ctx carrying a span context received from
+// another process, to become the parent of the next span started.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanFromRequest returns the server span of req, or nil.
+func SpanFromRequest(req *request.Request) *Span {
+	return SpanFromContext(req.Context())
+}
+
+func parentFrom(ctx context.Context) (SpanContext, bool) {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.SpanContext(), true
+	}
+	sc, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// Start starts a child of the span in ctx with the same tracer. Without a
+// span in ctx tracing is off and the returned span is nil.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
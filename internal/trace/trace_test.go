@@ -0,0 +1,187 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"httpFromTcp/internal/request"
+	"httpFromTcp/internal/response"
+	"httpFromTcp/internal/server"
+)
+
+// newTestTracer returns a tracer with sequential IDs and a clock advancing
+// one millisecond per call.
+func newTestTracer(exp Exporter) *Tracer {
+	now := time.Unix(1_700_000_000, 0)
+	t := NewTracer(exp, withClock(func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}))
+	var n byte
+	t.newIDs = func() (TraceID, SpanID) {
+		n++
+		return TraceID{15: n}, SpanID{7: n}
+	}
+	return t
+}
+
+func serve(t *testing.T, mw server.Middleware, h server.Handler, raw string) {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	req.RemoteAddr = "192.0.2.7:5555"
+	server.Chain(h, mw)(&response.Writer{Writer: &bytes.Buffer{}, State: response.StatusLine}, req)
+}
+
+func reply(status response.StatusCode) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(status)
+		w.WriteHeaders(response.GetDefaultHeaders(2, "text/plain", false))
+		w.Writer.Write([]byte("\r\n"))
+		w.WriteBody([]byte("ok"))
+	}
+}
+
+func attrs(s SpanData) map[string]any {
+	m := map[string]any{}
+	for _, a := range s.Attributes {
+		m[a.Key] = a.Value
+	}
+	return m
+}
+
+func TestMiddleware(t *testing.T) {
+	exp := NewInMemoryExporter()
+	mw := New(newTestTracer(exp), WithRoute(func(*request.Request) string { return "/items/" }))
+
+	// Test: New trace with a child span started by the handler
+	var handlerSpan *Span
+	serve(t, mw, func(w *response.Writer, req *request.Request) {
+		handlerSpan = SpanFromRequest(req)
+		_, child := Start(req.Context(), "load item", Internal)
+		child.End()
+		reply(response.Ok)(w, req)
+	}, "GET /items/1?full=yes HTTP/1.1\r\nUser-Agent: curl\r\n\r\n")
+
+	spans := exp.Spans()
+	require.Len(t, spans, 2)
+	child, srv := spans[0], spans[1]
+	assert.Equal(t, "GET /items/", srv.Name)
+	assert.Equal(t, Server, srv.Kind)
+	assert.Equal(t, handlerSpan.SpanContext(), srv.SpanContext)
+	assert.False(t, srv.Parent.IsValid())
+	assert.Equal(t, srv.SpanContext.TraceID, child.SpanContext.TraceID)
+	assert.Equal(t, srv.SpanContext.SpanID, child.Parent)
+	assert.Equal(t, Unset, srv.Status)
+	assert.Equal(t, map[string]any{
+		"http.request.method":       "GET",
+		"url.path":                  "/items/1",
+		"url.query":                 "full=yes",
+		"http.route":                "/items/",
+		"network.protocol.version":  "1.1",
+		"client.address":            "192.0.2.7",
+		"user_agent.original":       "curl",
+		"http.response.status_code": 200,
+		"http.response.body.size":   int64(2),
+	}, attrs(srv))
+
+	// Test: Remote parent and server errors
+	exp.Reset()
+	serve(t, mw, reply(response.BadGateway), "GET / HTTP/1.1\r\ntraceparent: "+validParent+"\r\ntracestate: rojo=1\r\n\r\n")
+	spans = exp.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.String())
+	assert.Equal(t, "rojo=1", spans[0].SpanContext.TraceState)
+	assert.Equal(t, Error, spans[0].Status)
+	assert.Equal(t, "Bad Gateway", spans[0].StatusMessage)
+
+	// Test: Unsampled parents are followed but not exported
+	exp.Reset()
+	serve(t, mw, reply(response.Ok), "GET / HTTP/1.1\r\ntraceparent: "+strings.TrimSuffix(validParent, "01")+"00\r\n\r\n")
+	assert.Empty(t, exp.Spans())
+}
+
+func TestStartWithoutTracer(t *testing.T) {
+	ctx, span := Start(context.Background(), "nothing", Client)
+	assert.Nil(t, span)
+	assert.Nil(t, SpanFromContext(ctx))
+
+	// Test: Nil spans are safe to use
+	span.SetAttribute("k", "v")
+	span.SetStatus(Error, "x")
+	span.End()
+	assert.False(t, span.SpanContext().IsValid())
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	exp, err := NewFileExporter(path, "httpserver")
+	require.NoError(t, err)
+	tracer := newTestTracer(exp)
+
+	ctx := ContextWithRemote(context.Background(), SpanContext{TraceID: TraceID{0: 0xab}, SpanID: SpanID{0: 0xcd}, Flags: FlagSampled})
+	_, span := tracer.Start(ctx, "GET", Client)
+	span.SetAttribute("http.response.status_code", 503)
+	span.SetAttribute("server.address", "backend:80")
+	span.SetAttribute("retry", true)
+	span.SetAttribute("ratio", 0.5)
+	span.SetStatus(Error, "Service Unavailable")
+	span.End()
+	span.End()
+	require.NoError(t, tracer.Shutdown())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.Len(t, lines, 1)
+
+	var data map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &data))
+	rs := data["resourceSpans"].([]any)[0].(map[string]any)
+	assert.Equal(t, `[{"key":"service.name","value":{"stringValue":"httpserver"}}]`, mustJSON(t, rs["resource"].(map[string]any)["attributes"]))
+	ss := rs["scopeSpans"].([]any)[0].(map[string]any)
+	assert.Equal(t, scopeName, ss["scope"].(map[string]any)["name"])
+
+	s := ss["spans"].([]any)[0].(map[string]any)
+	assert.Equal(t, "ab000000000000000000000000000000", s["traceId"])
+	assert.Equal(t, "0000000000000001", s["spanId"])
+	assert.Equal(t, "cd00000000000000", s["parentSpanId"])
+	assert.Equal(t, 3.0, s["kind"])
+	assert.Equal(t, 1.0, s["flags"])
+	assert.Equal(t, "1700000000001000000", s["startTimeUnixNano"])
+	assert.Equal(t, "1700000000002000000", s["endTimeUnixNano"])
+	assert.Equal(t, `{"code":2,"message":"Service Unavailable"}`, mustJSON(t, s["status"]))
+	assert.Equal(t, `[{"key":"http.response.status_code","value":{"intValue":"503"}},`+
+		`{"key":"server.address","value":{"stringValue":"backend:80"}},`+
+		`{"key":"retry","value":{"boolValue":true}},`+
+		`{"key":"ratio","value":{"doubleValue":0.5}}]`, mustJSON(t, s["attributes"]))
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func withClock(now func() time.Time) TracerOption {
+	return func(t *Tracer) {
+		t.now = now
+	}
+}